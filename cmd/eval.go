@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fingerprint/eval"
+	audio "fingerprint/wav"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runEval measures recognition rates on degraded queries cut from reference recordings.
+//
+//	audio-fp eval [--snr 0,5,10,20] [--holdout 1] [--system landmark,subfingerprint] ref...
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	snrList := fs.String("snr", "0,5,10,20", "comma-separated SNRs in dB for the noise degradations")
+	holdout := fs.Int("holdout", 0, "number of trailing references kept out of the index as negative queries")
+	systems := fs.String("system", "landmark,subfingerprint", "comma-separated systems to evaluate")
+	cfg := eval.DefaultConfig()
+	fs.Float64Var(&cfg.QueryLength, "length", cfg.QueryLength, "query length in seconds")
+	fs.IntVar(&cfg.QueriesPerReference, "queries", cfg.QueriesPerReference, "queries per reference")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *holdout >= fs.NArg() {
+		return errors.New("usage: eval [flags] ref... (at least one reference must be indexed)")
+	}
+
+	var snrs []float64
+	for _, s := range strings.Split(*snrList, ",") {
+		snr, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		snrs = append(snrs, snr)
+	}
+
+	var refs []eval.Reference
+	for _, path := range fs.Args() {
+		samples, sampleRate, err := audio.ReadAudioFile(path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, eval.Reference{Name: path, Samples: samples, SampleRate: sampleRate})
+	}
+	indexed, negatives := refs[:len(refs)-*holdout], refs[len(refs)-*holdout:]
+
+	for _, name := range strings.Split(*systems, ",") {
+		var system eval.System
+		switch strings.TrimSpace(name) {
+		case "landmark":
+			system = eval.NewLandmarkSystem()
+		case "subfingerprint":
+			system = eval.NewSubFingerprintSystem()
+		default:
+			return errors.New("unknown system " + name)
+		}
+		report, err := eval.Run(system, indexed, negatives, eval.Suite(snrs), cfg)
+		if err != nil {
+			return err
+		}
+		if err := report.WriteTable(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	audio "fingerprint/wav"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// inputFlags selects how an input argument is read: as an audio file, or as
+// headerless PCM when --raw is set. The path "-" reads from stdin.
+// --channel, --downmix and --split control channel handling of WAV files,
+// and --strict rejects malformed WAV files instead of repairing them.
+type inputFlags struct {
+	raw     bool
+	format  audio.RawFormat
+	channel int
+	downmix string
+	split   bool
+	strict  bool
+}
+
+// input is one signal to fingerprint. Label names the channel when a file
+// is split.
+type input struct {
+	label      string
+	samples    []int16
+	sampleRate int
+	start      time.Time         // Wall-clock time of the first sample, zero if unknown.
+	metadata   map[string]string // Broadcast WAV metadata.
+}
+
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	in := &inputFlags{}
+	fs.BoolVar(&in.raw, "raw", false, "read headerless PCM instead of an audio file")
+	fs.StringVar(&in.format.Encoding, "format", "s16le", "raw sample encoding: s16le, s24le, s32le or f32le")
+	fs.IntVar(&in.format.SampleRate, "rate", 44100, "raw sample rate in Hz")
+	fs.IntVar(&in.format.NumChannels, "channels", 1, "raw channel count")
+	fs.IntVar(&in.channel, "channel", 0, "read only this 1-based WAV channel")
+	fs.StringVar(&in.downmix, "downmix", "average", "WAV downmix: average or itu")
+	fs.BoolVar(&in.split, "split", false, "fingerprint every WAV channel separately")
+	fs.BoolVar(&in.strict, "strict", false, "reject malformed or truncated WAV files instead of repairing them")
+	return in
+}
+
+// read returns the mono samples and sample rate of path.
+func (in *inputFlags) read(path string) ([]int16, int, error) {
+	if in.split {
+		return nil, 0, errors.New("--split is not supported here")
+	}
+	inputs, err := in.readAll(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return inputs[0].samples, inputs[0].sampleRate, nil
+}
+
+// readAll returns the signals to fingerprint from path: one per channel
+// with --split, otherwise a single mono signal.
+func (in *inputFlags) readAll(path string) ([]input, error) {
+	if in.raw {
+		if in.split || in.channel != 0 || in.downmix != "average" || in.strict {
+			return nil, errors.New("channel options are only supported for WAV files")
+		}
+		samples, err := in.readRaw(path)
+		if err != nil {
+			return nil, err
+		}
+		return []input{{label: path, samples: samples, sampleRate: in.format.SampleRate}}, nil
+	}
+	if path == "-" {
+		return nil, errors.New("reading from stdin requires --raw")
+	}
+
+	format, err := audio.FileFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	if format != "wav" {
+		if in.split || in.channel != 0 || in.downmix != "average" || in.strict {
+			return nil, errors.New("channel options are only supported for WAV files")
+		}
+		samples, sampleRate, err := audio.ReadAudioFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []input{{label: path, samples: samples, sampleRate: sampleRate}}, nil
+	}
+
+	opts := audio.ReadOptions{Channel: in.channel, Strict: in.strict}
+	switch in.downmix {
+	case "average":
+	case "itu":
+		opts.Downmix = audio.DownmixITU
+	default:
+		return nil, fmt.Errorf("unknown downmix %q", in.downmix)
+	}
+	wav, err := audio.ReadWav(path, opts.Strict)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range wav.Warnings {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, w)
+	}
+	start, metadata, err := wavMetadata(path, wav, in.strict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if in.split {
+		var inputs []input
+		for c, samples := range wav.Split() {
+			inputs = append(inputs, input{
+				label:      fmt.Sprintf("%s [ch %d]", path, c+1),
+				samples:    samples,
+				sampleRate: wav.SampleRate,
+				start:      start,
+				metadata:   metadata,
+			})
+		}
+		return inputs, nil
+	}
+	samples, err := wav.Mono(opts)
+	if err != nil {
+		return nil, err
+	}
+	return []input{{label: path, samples: samples, sampleRate: wav.SampleRate, start: start, metadata: metadata}}, nil
+}
+
+// wavMetadata collects the start time and metadata of a broadcast WAV file
+// from its bext and iXML chunks. The metadata is optional, so a malformed
+// chunk is reported and skipped unless strict is set.
+func wavMetadata(path string, wav *audio.WavFile, strict bool) (time.Time, map[string]string, error) {
+	var start time.Time
+	metadata := map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	skip := func(err error) error {
+		if strict {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s: ignoring metadata: %v\n", path, err)
+		return nil
+	}
+
+	bext, err := wav.Bext()
+	if err != nil {
+		if err := skip(err); err != nil {
+			return start, nil, err
+		}
+		bext = nil
+	}
+	if bext != nil {
+		set("description", bext.Description)
+		set("originator", bext.Originator)
+		set("originator_reference", bext.OriginatorReference)
+		start, _ = bext.StartTime(wav.SampleRate)
+	}
+
+	ixml, err := wav.IXML()
+	if err != nil {
+		if err := skip(err); err != nil {
+			return start, nil, err
+		}
+		ixml = nil
+	}
+	if ixml != nil {
+		set("project", ixml.Project)
+		set("scene", ixml.Scene)
+		set("take", ixml.Take)
+		set("tape", ixml.Tape)
+		set("note", ixml.Note)
+	}
+
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return start, metadata, nil
+}
+
+func (in *inputFlags) readRaw(path string) ([]int16, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	return audio.ReadRawPCM(f, in.format)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fingerprint/fingerprint"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runInspect renders the spectrogram and peak constellation of an audio file.
+//
+//	audio-fp inspect --png out.png [--pairs] [--raw ...] file|-
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	out := fs.String("png", "inspect.png", "output PNG path")
+	pairs := fs.Bool("pairs", false, "draw lines for the peak pairs that make up the hashes")
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: inspect --png out.png [--pairs] file")
+	}
+
+	samples, sampleRate, err := in.read(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	spectrogram, err := fingerprint.Spectrogram(samples, sampleRate)
+	if err != nil {
+		return err
+	}
+	peaks := fingerprint.DetectPeaks(spectrogram, fingerprint.NumBands)
+
+	var landmarks []fingerprint.Landmark
+	if *pairs {
+		landmarks = fingerprint.Landmarks(peaks, fingerprint.TargetZoneFrames)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := fingerprint.RenderConstellation(f, spectrogram, peaks, landmarks); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %d frames, %d peaks, %d pairs\n", *out, len(spectrogram), len(peaks), len(landmarks))
+	return nil
+}
@@ -5,14 +5,40 @@ import (
 	audio "fingerprint/wav"
 	"fmt"
 	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "inspect":
+			if err := runInspect(os.Args[2:]); err != nil {
+				log.Fatalf("inspect: %v", err)
+			}
+			return
+		case "index":
+			if err := runIndex(os.Args[2:]); err != nil {
+				log.Fatalf("index: %v", err)
+			}
+			return
+		case "query":
+			if err := runQuery(os.Args[2:]); err != nil {
+				log.Fatalf("query: %v", err)
+			}
+			return
+		case "eval":
+			if err := runEval(os.Args[2:]); err != nil {
+				log.Fatalf("eval: %v", err)
+			}
+			return
+		}
+	}
+
 	audioFile := "assets/audio.wav"
 
-	samples, sampleRate, err := audio.ReadWavFile(audioFile)
+	samples, sampleRate, err := audio.ReadAudioFile(audioFile)
 	if err != nil {
-		log.Fatalf("Failed to read WAV file: %v", err)
+		log.Fatalf("Failed to read audio file: %v", err)
 	}
 
 	hashes, err := fingerprint.Fingerprint(samples, sampleRate)
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fingerprint/feature"
+	"fingerprint/fingerprint"
+	"fingerprint/index"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"strconv"
+)
+
+// landmarksOf returns the landmarks of a signal.
+func landmarksOf(in input) ([]fingerprint.Landmark, error) {
+	peaks, err := fingerprint.ExtractPeaks(in.samples, in.sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return fingerprint.Landmarks(peaks, fingerprint.TargetZoneFrames), nil
+}
+
+// analyzeReference returns the landmarks of a reference recording and its
+// metadata with the measured loudness and, optionally, the onset and tempo
+// features added for the catalogue. useFloat32 selects the float32 pipeline.
+func analyzeReference(in input, withFeatures, useFloat32 bool) ([]fingerprint.Landmark, map[string]string, error) {
+	config := fingerprint.Config{MeasureLoudness: true, Float32: useFloat32, KeepSpectrogram: withFeatures}
+	result, err := config.Analyze(in.samples, in.sampleRate)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := map[string]string{}
+	maps.Copy(metadata, in.metadata)
+	if !math.IsInf(result.Loudness, -1) {
+		metadata["loudness"] = strconv.FormatFloat(result.Loudness, 'f', 1, 64)
+	}
+	if withFeatures {
+		maps.Copy(metadata, feature.ExtractFromSpectrogram(result.Spectrogram).Metadata())
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return fingerprint.Landmarks(result.Peaks, fingerprint.TargetZoneFrames), metadata, nil
+}
+
+// runIndex adds reference recordings to a fingerprint database, creating it
+// if it does not exist. With --split every channel becomes its own track,
+// and with --features onsets, tempo and beats are stored with each track.
+// --float32 analyses long recordings in a fraction of the memory.
+//
+//	audio-fp index [--db fingerprints.db] [--raw ...] [--split] [--features] [--float32] file...
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	db := fs.String("db", "fingerprints.db", "fingerprint database path")
+	withFeatures := fs.Bool("features", false, "store onset, tempo and beat features with each track")
+	useFloat32 := fs.Bool("float32", false, "analyse in float32 to save memory on long recordings")
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: index [--db path] [--features] [--float32] [--raw --format s16le --rate 44100 --channels 1] file...")
+	}
+
+	ix, err := loadIndex(*db)
+	if errors.Is(err, os.ErrNotExist) {
+		ix = index.New()
+	} else if err != nil {
+		return err
+	}
+	for _, path := range fs.Args() {
+		inputs, err := in.readAll(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, input := range inputs {
+			landmarks, metadata, err := analyzeReference(input, *withFeatures, *useFloat32)
+			if err != nil {
+				return fmt.Errorf("%s: %w", input.label, err)
+			}
+			track := ix.Add(index.Track{Name: input.label, Start: input.start, Metadata: metadata}, landmarks)
+			fmt.Printf("added %s as track %d: %d landmarks", input.label, track.ID, len(landmarks))
+			if loudness, ok := metadata["loudness"]; ok {
+				fmt.Printf(", %s LUFS", loudness)
+			}
+			if tempo, ok := metadata["tempo"]; ok {
+				fmt.Printf(", %s BPM", tempo)
+			}
+			fmt.Println()
+		}
+	}
+
+	return ix.SaveFile(*db)
+}
+
+// runQuery identifies a recording against a fingerprint database. With
+// --raw and the path "-", headerless PCM is read from stdin:
+//
+//	recorder | audio-fp query --raw --format s16le --rate 48000 --channels 2 -
+//
+// With --split every channel of a WAV file is identified separately.
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	db := fs.String("db", "fingerprints.db", "fingerprint database path")
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: query [--db path] [--raw --format s16le --rate 44100 --channels 1] file|-")
+	}
+
+	ix, err := loadIndex(*db)
+	if err != nil {
+		return err
+	}
+	inputs, err := in.readAll(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		landmarks, err := landmarksOf(input)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if in.split {
+			prefix = input.label + ": "
+		}
+		match, ok := ix.Match(landmarks)
+		if !ok {
+			fmt.Printf("%sno match\n", prefix)
+			continue
+		}
+		fmt.Printf("%s%s at %.2fs (score %d)", prefix, match.Track.Name, match.OffsetSeconds(), match.Score)
+		if t, ok := match.Time(); ok {
+			fmt.Printf(", recorded %s", t.Format("2006-01-02 15:04:05.000"))
+		}
+		if originator := match.Track.Metadata["originator"]; originator != "" {
+			fmt.Printf(", originator %s", originator)
+		}
+		if tempo := match.Track.Metadata["tempo"]; tempo != "" {
+			fmt.Printf(", tempo %s BPM", tempo)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func loadIndex(path string) (*index.Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return index.Load(f)
+}
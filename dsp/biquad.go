@@ -0,0 +1,252 @@
+package dsp
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// Filter is a stateful filter that processes a signal in consecutive
+// blocks, so that a stream can be filtered chunk by chunk with the same
+// result as filtering it whole.
+type Filter interface {
+	// Process filters the next block and returns one output sample per
+	// input sample.
+	Process(block []float64) []float64
+	// Reset clears the state, as if the stream started again.
+	Reset()
+}
+
+// Biquad is a second-order IIR section, normalised so that a0 = 1:
+//
+//	y[n] = B0*x[n] + B1*x[n-1] + B2*x[n-2] - A1*y[n-1] - A2*y[n-2]
+//
+// It runs in transposed direct form II and keeps its state between calls.
+type Biquad struct {
+	B0, B1, B2 float64
+	A1, A2     float64
+	z1, z2     float64
+}
+
+// newBiquad normalises the coefficients by a0.
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	return &Biquad{B0: b0 / a0, B1: b1 / a0, B2: b2 / a0, A1: a1 / a0, A2: a2 / a0}
+}
+
+// rbjParams returns cos(w0) and the bandwidth term alpha of the Audio EQ
+// Cookbook (R. Bristow-Johnson) for a centre or corner frequency and Q.
+func rbjParams(freq, q float64, sampleRate int) (cosW, alpha float64) {
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	return math.Cos(w0), math.Sin(w0) / (2 * q)
+}
+
+// NewLowPassBiquad returns a second-order low-pass filter. A Q of
+// 1/sqrt(2) gives a Butterworth response, -3 dB at freq.
+func NewLowPassBiquad(freq, q float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, q, sampleRate)
+	return newBiquad((1-c)/2, 1-c, (1-c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+// NewHighPassBiquad returns a second-order high-pass filter.
+func NewHighPassBiquad(freq, q float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, q, sampleRate)
+	return newBiquad((1+c)/2, -(1 + c), (1+c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+// NewBandPassBiquad returns a band-pass filter with unit gain at freq and
+// a bandwidth of freq/q.
+func NewBandPassBiquad(freq, q float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, q, sampleRate)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*c, 1-alpha)
+}
+
+// NewNotchBiquad returns a filter that removes freq, with a bandwidth of
+// freq/q, e.g. for mains hum.
+func NewNotchBiquad(freq, q float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, q, sampleRate)
+	return newBiquad(1, -2*c, 1, 1+alpha, -2*c, 1-alpha)
+}
+
+// NewPeakingBiquad returns a peaking equaliser that changes the gain at
+// freq by gainDB, with a bandwidth of freq/q.
+func NewPeakingBiquad(freq, q, gainDB float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, q, sampleRate)
+	a := math.Pow(10, gainDB/40)
+	return newBiquad(1+alpha*a, -2*c, 1-alpha*a, 1+alpha/a, -2*c, 1-alpha/a)
+}
+
+// NewLowShelfBiquad returns a shelving filter that changes the gain below
+// freq by gainDB, with the steepest slope that does not overshoot.
+func NewLowShelfBiquad(freq, gainDB float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, 1/math.Sqrt2, sampleRate)
+	a := math.Pow(10, gainDB/40)
+	s := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)-(a-1)*c+s), 2*a*((a-1)-(a+1)*c), a*((a+1)-(a-1)*c-s),
+		(a+1)+(a-1)*c+s, -2*((a-1)+(a+1)*c), (a+1)+(a-1)*c-s)
+}
+
+// NewHighShelfBiquad returns a shelving filter that changes the gain above
+// freq by gainDB.
+func NewHighShelfBiquad(freq, gainDB float64, sampleRate int) *Biquad {
+	c, alpha := rbjParams(freq, 1/math.Sqrt2, sampleRate)
+	a := math.Pow(10, gainDB/40)
+	s := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)+(a-1)*c+s), -2*a*((a-1)+(a+1)*c), a*((a+1)+(a-1)*c-s),
+		(a+1)-(a-1)*c+s, 2*((a-1)-(a+1)*c), (a+1)-(a-1)*c-s)
+}
+
+// ProcessSample filters one sample.
+func (b *Biquad) ProcessSample(x float64) float64 {
+	y := b.B0*x + b.z1
+	b.z1 = b.B1*x - b.A1*y + b.z2
+	b.z2 = b.B2*x - b.A2*y
+	return y
+}
+
+// Process filters the next block.
+func (b *Biquad) Process(block []float64) []float64 {
+	out := make([]float64, len(block))
+	for i, x := range block {
+		out[i] = b.ProcessSample(x)
+	}
+	return out
+}
+
+// Reset clears the filter state.
+func (b *Biquad) Reset() {
+	b.z1, b.z2 = 0, 0
+}
+
+// Gain returns the linear gain of the section at freq.
+func (b *Biquad) Gain(freq float64, sampleRate int) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(sampleRate)))
+	num := complex(b.B0, 0) + complex(b.B1, 0)*z + complex(b.B2, 0)*z*z
+	den := 1 + complex(b.A1, 0)*z + complex(b.A2, 0)*z*z
+	return cmplx.Abs(num / den)
+}
+
+// Cascade runs biquad sections in series.
+type Cascade []*Biquad
+
+// NewButterworth returns a Butterworth low-pass or high-pass filter of the
+// given order as a cascade of biquads, -3 dB at freq. An odd order adds a
+// first-order section.
+func NewButterworth(filterType FilterType, freq float64, order, sampleRate int) (Cascade, error) {
+	if filterType != LowPass && filterType != HighPass {
+		return nil, errors.New("butterworth filters must be low-pass or high-pass")
+	}
+	if order < 1 {
+		return nil, errors.New("filter order must be positive")
+	}
+	var cascade Cascade
+	for k := 0; k < order/2; k++ {
+		// Angle of each conjugate pole pair from the negative real axis.
+		angle := float64(2*k+1) * math.Pi / float64(2*order)
+		if order%2 == 1 {
+			angle = float64(k+1) * math.Pi / float64(order)
+		}
+		q := 1 / (2 * math.Cos(angle))
+		if filterType == LowPass {
+			cascade = append(cascade, NewLowPassBiquad(freq, q, sampleRate))
+		} else {
+			cascade = append(cascade, NewHighPassBiquad(freq, q, sampleRate))
+		}
+	}
+	if order%2 == 1 {
+		// First-order section by the bilinear transform.
+		k := math.Tan(math.Pi * freq / float64(sampleRate))
+		a1 := (k - 1) / (k + 1)
+		if filterType == LowPass {
+			cascade = append(cascade, &Biquad{B0: k / (k + 1), B1: k / (k + 1), A1: a1})
+		} else {
+			cascade = append(cascade, &Biquad{B0: 1 / (k + 1), B1: -1 / (k + 1), A1: a1})
+		}
+	}
+	return cascade, nil
+}
+
+// Process filters the next block through every section.
+func (c Cascade) Process(block []float64) []float64 {
+	out := make([]float64, len(block))
+	for i, x := range block {
+		for _, b := range c {
+			x = b.ProcessSample(x)
+		}
+		out[i] = x
+	}
+	return out
+}
+
+// Reset clears the state of every section.
+func (c Cascade) Reset() {
+	for _, b := range c {
+		b.Reset()
+	}
+}
+
+// Gain returns the linear gain of the cascade at freq.
+func (c Cascade) Gain(freq float64, sampleRate int) float64 {
+	g := 1.0
+	for _, b := range c {
+		g *= b.Gain(freq, sampleRate)
+	}
+	return g
+}
+
+// DCBlocker removes a constant offset and very low frequencies with the
+// one-pole, one-zero filter y[n] = x[n] - x[n-1] + R*y[n-1].
+type DCBlocker struct {
+	R      float64
+	x1, y1 float64
+}
+
+// NewDCBlocker returns a DC blocker whose -3 dB point is about cutoff Hz.
+func NewDCBlocker(cutoff float64, sampleRate int) *DCBlocker {
+	return &DCBlocker{R: 1 - 2*math.Pi*cutoff/float64(sampleRate)}
+}
+
+// Process filters the next block.
+func (d *DCBlocker) Process(block []float64) []float64 {
+	out := make([]float64, len(block))
+	for i, x := range block {
+		d.y1 = x - d.x1 + d.R*d.y1
+		d.x1 = x
+		out[i] = d.y1
+	}
+	return out
+}
+
+// Reset clears the filter state.
+func (d *DCBlocker) Reset() {
+	d.x1, d.y1 = 0, 0
+}
+
+// PreEmphasis boosts high frequencies with y[n] = x[n] - Alpha*x[n-1], so
+// that weak upper harmonics compete with strong low ones for peaks.
+type PreEmphasis struct {
+	Alpha float64
+	x1    float64
+}
+
+// NewPreEmphasis returns a pre-emphasis filter; 0.95 to 0.97 are usual
+// coefficients.
+func NewPreEmphasis(alpha float64) *PreEmphasis {
+	return &PreEmphasis{Alpha: alpha}
+}
+
+// Process filters the next block.
+func (p *PreEmphasis) Process(block []float64) []float64 {
+	out := make([]float64, len(block))
+	for i, x := range block {
+		out[i] = x - p.Alpha*p.x1
+		p.x1 = x
+	}
+	return out
+}
+
+// Reset clears the filter state.
+func (p *PreEmphasis) Reset() {
+	p.x1 = 0
+}
@@ -0,0 +1,224 @@
+package dsp
+
+import (
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// DirectConvolutionMaxTaps is the longest kernel that Convolve and
+// Convolver apply with a direct loop. Longer kernels use FFT overlap-save,
+// whose cost grows with the logarithm of the kernel length instead of
+// linearly.
+const DirectConvolutionMaxTaps = 32
+
+// Boundary selects how Convolve treats samples before the start and after
+// the end of the input.
+type Boundary int
+
+const (
+	// BoundaryZero treats samples outside the input as zero, so the
+	// output fades at the edges. This is what ApplyFIRFilter does.
+	BoundaryZero Boundary = iota
+	// BoundaryReflect mirrors the input about its first and last samples
+	// without repeating them: x[-1] = x[1].
+	BoundaryReflect
+	// BoundaryNearest repeats the first and last samples.
+	BoundaryNearest
+	// BoundaryPeriodic wraps around, treating the input as one period of
+	// a periodic signal.
+	BoundaryPeriodic
+)
+
+// Convolve applies kernel to input and returns an output of the same
+// length, centred like ApplyFIRFilter:
+//
+//	output[i] = sum over j of input[i+j-len(kernel)/2] * kernel[j]
+//
+// This is a correlation, which equals convolution for the symmetric
+// kernels designed in this package. Samples outside the input are
+// supplied by boundary. Kernels longer than DirectConvolutionMaxTaps are
+// applied with FFT overlap-save; the result matches the direct loop to
+// within rounding.
+func Convolve(input, kernel []float64, boundary Boundary) []float64 {
+	n, k := len(input), len(kernel)
+	if k == 0 || n == 0 {
+		return make([]float64, n)
+	}
+	half := k / 2
+	padded := make([]float64, n+k-1)
+	for i := range padded {
+		if idx, ok := boundaryIndex(i-half, n, boundary); ok {
+			padded[i] = input[idx]
+		}
+	}
+	return newCorrelator(kernel, n).valid(padded)
+}
+
+// boundaryIndex maps an index outside [0, n) into the input according to
+// boundary. It reports false for samples that are zero.
+func boundaryIndex(i, n int, boundary Boundary) (int, bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+	switch boundary {
+	case BoundaryReflect:
+		if n == 1 {
+			return 0, true
+		}
+		period := 2 * (n - 1)
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - i
+		}
+		return i, true
+	case BoundaryNearest:
+		return min(max(i, 0), n-1), true
+	case BoundaryPeriodic:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+// correlator computes valid correlations with a fixed kernel, directly or
+// by FFT overlap-save.
+type correlator struct {
+	kernel   []float64
+	fft      *fourier.FFT // Nil for the direct loop.
+	spectrum []complex128 // Transform of the reversed, zero-padded kernel.
+	block    []float64
+	coeffs   []complex128
+}
+
+// newCorrelator prepares kernel for inputs of about outputs samples.
+// Overlap-save is used for long kernels when there are enough outputs to
+// amortise the transforms.
+func newCorrelator(kernel []float64, outputs int) *correlator {
+	c := &correlator{kernel: kernel}
+	k := len(kernel)
+	if k <= DirectConvolutionMaxTaps || outputs < k {
+		return c
+	}
+
+	// Blocks of about 8 kernel lengths balance the cost of each transform
+	// against the k-1 samples of overlap discarded per block.
+	n := 1
+	for n < 8*k {
+		n <<= 1
+	}
+	c.fft = fourier.NewFFT(n)
+	reversed := make([]float64, n)
+	for j, v := range kernel {
+		reversed[k-1-j] = v / float64(n) // Sequence is unnormalised.
+	}
+	c.spectrum = c.fft.Coefficients(nil, reversed)
+	c.block = make([]float64, n)
+	c.coeffs = make([]complex128, n/2+1)
+	return c
+}
+
+// valid returns the len(x)-len(kernel)+1 outputs
+//
+//	output[i] = sum over j of x[i+j] * kernel[j]
+//
+// for which the kernel lies entirely inside x.
+func (c *correlator) valid(x []float64) []float64 {
+	k := len(c.kernel)
+	outputs := len(x) - k + 1
+	if outputs <= 0 {
+		return []float64{}
+	}
+	output := make([]float64, outputs)
+
+	if c.fft == nil {
+		for i := range output {
+			acc := 0.0
+			for j, v := range c.kernel {
+				acc += x[i+j] * v
+			}
+			output[i] = acc
+		}
+		return output
+	}
+
+	// Overlap-save: each block of n input samples yields n-k+1 outputs,
+	// taken from the part of the circular convolution that did not wrap.
+	n := len(c.block)
+	step := n - k + 1
+	for start := 0; start < outputs; start += step {
+		copied := copy(c.block, x[start:])
+		clear(c.block[copied:])
+		c.fft.Coefficients(c.coeffs, c.block)
+		for i := range c.coeffs {
+			c.coeffs[i] *= c.spectrum[i]
+		}
+		c.fft.Sequence(c.block, c.coeffs)
+		copy(output[start:], c.block[k-1:])
+	}
+	return output
+}
+
+// Convolver applies an FIR kernel to a signal that arrives in blocks,
+// keeping the last len(kernel)-1 input samples between calls. The output
+// is causal: it lags the centred output of Convolve with BoundaryZero by
+// Delay samples.
+type Convolver struct {
+	kernel  []float64
+	history []float64
+	corr    *correlator
+	blockN  int // Block length corr was prepared for.
+}
+
+// NewConvolver returns a streaming filter for kernel, starting from
+// silence.
+func NewConvolver(kernel []float64) *Convolver {
+	c := &Convolver{kernel: kernel}
+	c.Reset()
+	return c
+}
+
+// Reset clears the filter state.
+func (c *Convolver) Reset() {
+	c.history = make([]float64, max(len(c.kernel)-1, 0))
+}
+
+// Delay returns the number of samples by which the output lags the
+// centred output of Convolve.
+func (c *Convolver) Delay() int {
+	if len(c.kernel) == 0 {
+		return 0
+	}
+	return len(c.kernel) - 1 - len(c.kernel)/2
+}
+
+// Process filters the next block and returns one output sample per input
+// sample.
+func (c *Convolver) Process(block []float64) []float64 {
+	if len(c.kernel) == 0 {
+		return make([]float64, len(block))
+	}
+	// Reuse the prepared transform while the block length is steady.
+	if c.corr == nil || c.blockN != len(block) {
+		c.corr = newCorrelator(c.kernel, len(block))
+		c.blockN = len(block)
+	}
+	buf := append(c.history, block...)
+	output := c.corr.valid(buf)
+	c.history = append(c.history[:0:0], buf[len(buf)-len(c.history):]...)
+	return output
+}
+
+// Flush feeds Delay zeros through the filter and returns the output, so
+// that the outputs of all Process calls and Flush, without their first
+// Delay samples, equal Convolve with BoundaryZero over the whole signal.
+// The filter is reset afterwards.
+func (c *Convolver) Flush() []float64 {
+	output := c.Process(make([]float64, c.Delay()))
+	c.Reset()
+	return output
+}
@@ -3,6 +3,8 @@ package dsp_test
 import (
 	"fingerprint/dsp"
 	"math"
+	"math/cmplx"
+	"math/rand"
 	"testing"
 )
 
@@ -135,3 +137,985 @@ func TestComputeFFTConstant(t *testing.T) {
 		t.Errorf("ComputeFFT(constant) = %v, want %v", output, expected)
 	}
 }
+
+// tone returns seconds of a unit sine at freq Hz.
+func tone(freq float64, sampleRate int, seconds float64) []float64 {
+	out := make([]float64, int(seconds*float64(sampleRate)))
+	for i := range out {
+		out[i] = math.Sin(2 * math.Pi * freq * float64(i) / float64(sampleRate))
+	}
+	return out
+}
+
+// rms returns the root mean square of x, skipping edge samples where the
+// filters start up.
+func rms(x []float64, edge int) float64 {
+	sum := 0.0
+	for _, v := range x[edge : len(x)-edge] {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(x)-2*edge))
+}
+
+// filterThenDecimate is the path the resampler replaces: filter at the
+// input rate, then keep every factor-th sample.
+func filterThenDecimate(input []float64, sampleRate, outRate, factor int) []float64 {
+	filtered := dsp.ApplyFIRFilter(input, dsp.GenerateLowPassKernel(float64(outRate)/2, sampleRate, 101))
+	out := make([]float64, 0, len(filtered)/factor+1)
+	for i := 0; i < len(filtered); i += factor {
+		out = append(out, filtered[i])
+	}
+	return out
+}
+
+func TestResamplerMatchesFilterThenDecimate(t *testing.T) {
+	input := make([]float64, 10001)
+	for i := range input {
+		input[i] = math.Sin(float64(i)*0.37) + 0.5*math.Cos(float64(i)*1.91)
+	}
+	expected := filterThenDecimate(input, 44100, 11025, 4)
+	output := dsp.NewResampler(44100, 11025, 101).Resample(input)
+	if len(output) != len(expected) {
+		t.Fatalf("expected %d samples, got %d", len(expected), len(output))
+	}
+	// ApplyFIRFilter convolves through the FFT, so the samples agree to
+	// rounding rather than exactly.
+	for i := range output {
+		if !almostEqual(output[i], expected[i], 1e-12) {
+			t.Fatalf("sample %d: expected %v, got %v", i, expected[i], output[i])
+		}
+	}
+}
+
+func TestResamplerRationalRates(t *testing.T) {
+	// 48000 Hz uses 147 exact phases; 44101 Hz needs more than
+	// MaxResamplerPhases and rounds to the nearest one.
+	for _, rate := range []int{48000, 32000, 44101} {
+		input := tone(1000, rate, 1)
+		output := dsp.NewResampler(rate, 11025, 101).Resample(input)
+		if want := (len(input)*11025 + rate - 1) / rate; len(output) != want {
+			t.Errorf("%d Hz: expected %d samples, got %d", rate, want, len(output))
+		}
+		expected := tone(1000, 11025, 1)
+		for i := 100; i < len(output)-100; i++ {
+			if !almostEqual(output[i], expected[i], 0.01) {
+				t.Errorf("%d Hz: sample %d: expected %f, got %f", rate, i, expected[i], output[i])
+				break
+			}
+		}
+	}
+}
+
+func TestMultiStageResampler(t *testing.T) {
+	tests := []struct {
+		rate   int
+		stages int
+	}{
+		{44100, 1},
+		{48000, 1},
+		{88200, 2},
+		{192000, 3},
+	}
+	for _, tc := range tests {
+		if got := dsp.NewMultiStageResampler(tc.rate, 11025, 101).Stages(); got != tc.stages {
+			t.Errorf("%d Hz: expected %d stages, got %d", tc.rate, tc.stages, got)
+		}
+	}
+
+	// A 1 kHz tone passes; a 7 kHz tone, which would alias to 4 kHz, is
+	// rejected far better than by one 101-tap filter at 192 kHz.
+	multi := dsp.NewMultiStageResampler(192000, 11025, 101)
+	single := dsp.NewResampler(192000, 11025, 101)
+	if got := rms(multi.Resample(tone(1000, 192000, 1)), 100); !almostEqual(got, math.Sqrt2/2, 0.01) {
+		t.Errorf("expected passband RMS %f, got %f", math.Sqrt2/2, got)
+	}
+	multiAlias := rms(multi.Resample(tone(7000, 192000, 1)), 100)
+	singleAlias := rms(single.Resample(tone(7000, 192000, 1)), 100)
+	if multiAlias > 0.01 || multiAlias > singleAlias/10 {
+		t.Errorf("expected alias RMS below 0.01 and a tenth of %f, got %f", singleAlias, multiAlias)
+	}
+}
+
+func benchmarkInput(sampleRate int) []float64 {
+	input := make([]float64, 10*sampleRate)
+	for i := range input {
+		input[i] = math.Sin(float64(i)*0.37) + 0.5*math.Cos(float64(i)*1.91)
+	}
+	return input
+}
+
+func BenchmarkFilterThenDecimate44100(b *testing.B) {
+	input := benchmarkInput(44100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterThenDecimate(input, 44100, 11025, 4)
+	}
+}
+
+func BenchmarkResampler44100(b *testing.B) {
+	input := benchmarkInput(44100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dsp.NewResampler(44100, 11025, 101).Resample(input)
+	}
+}
+
+func BenchmarkFilterThenDecimate192000(b *testing.B) {
+	input := benchmarkInput(192000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterThenDecimate(input, 192000, 12000, 16)
+	}
+}
+
+func BenchmarkResampler192000(b *testing.B) {
+	input := benchmarkInput(192000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dsp.NewResampler(192000, 11025, 101).Resample(input)
+	}
+}
+
+func BenchmarkMultiStageResampler192000(b *testing.B) {
+	input := benchmarkInput(192000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dsp.NewMultiStageResampler(192000, 11025, 101).Resample(input)
+	}
+}
+
+func BenchmarkMultiStageResamplerInt16(b *testing.B) {
+	input := benchmarkInput(192000)
+	samples := make([]int16, len(input))
+	for i, x := range input {
+		samples[i] = int16(x * 20000)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dsp.NewMultiStageResampler(192000, 11025, 101).ResampleInt16(samples)
+	}
+}
+
+// directConvolve is the reference definition of Convolve with zero
+// boundaries.
+func directConvolve(input, kernel []float64) []float64 {
+	output := make([]float64, len(input))
+	half := len(kernel) / 2
+	for i := range output {
+		for j, v := range kernel {
+			if idx := i + j - half; idx >= 0 && idx < len(input) {
+				output[i] += input[idx] * v
+			}
+		}
+	}
+	return output
+}
+
+func randomSignal(rng *rand.Rand, n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = rng.Float64()*2 - 1
+	}
+	return x
+}
+
+func TestConvolveFFTMatchesDirect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// Odd, even, short and long kernels, including ones longer than the
+	// signal, which fall back to the direct loop.
+	for _, k := range []int{1, 4, 32, 33, 200, 1000, 3000} {
+		input := randomSignal(rng, 2500)
+		kernel := randomSignal(rng, k)
+		if got, want := dsp.Convolve(input, kernel, dsp.BoundaryZero), directConvolve(input, kernel); !slicesAlmostEqual(got, want, 1e-9) {
+			t.Errorf("%d taps: FFT and direct convolution differ", k)
+		}
+	}
+}
+
+func TestConvolveBoundaries(t *testing.T) {
+	input := []float64{1, 2, 3, 4}
+	// The kernel picks the sample two before and two after each output.
+	kernel := []float64{1, 0, 0, 0, 10}
+	tests := []struct {
+		boundary dsp.Boundary
+		expected []float64
+	}{
+		{dsp.BoundaryZero, []float64{30, 40, 1, 2}},
+		{dsp.BoundaryReflect, []float64{33, 42, 31, 22}},
+		{dsp.BoundaryNearest, []float64{31, 41, 41, 42}},
+		{dsp.BoundaryPeriodic, []float64{33, 44, 11, 22}},
+	}
+	for _, tc := range tests {
+		if got := dsp.Convolve(input, kernel, tc.boundary); !slicesAlmostEqual(got, tc.expected, 1e-9) {
+			t.Errorf("boundary %d: expected %v, got %v", tc.boundary, tc.expected, got)
+		}
+	}
+}
+
+func TestConvolverStreaming(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, k := range []int{5, 101, 255} {
+		input := randomSignal(rng, 5000)
+		kernel := randomSignal(rng, k)
+
+		c := dsp.NewConvolver(kernel)
+		var streamed []float64
+		for rest := input; len(rest) > 0; {
+			n := min(len(rest), 1+rng.Intn(700))
+			streamed = append(streamed, c.Process(rest[:n])...)
+			rest = rest[n:]
+		}
+		streamed = append(streamed, c.Flush()...)
+
+		if got, want := streamed[c.Delay():], dsp.Convolve(input, kernel, dsp.BoundaryZero); !slicesAlmostEqual(got, want, 1e-9) {
+			t.Errorf("%d taps: streamed output differs from Convolve", k)
+		}
+	}
+}
+
+func benchmarkConvolve(b *testing.B, taps int, convolve func(input, kernel []float64) []float64) {
+	input := benchmarkInput(11025)
+	kernel := dsp.GenerateLowPassKernel(1000, 11025, taps)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		convolve(input, kernel)
+	}
+}
+
+func BenchmarkConvolveDirect255(b *testing.B) { benchmarkConvolve(b, 255, directConvolve) }
+func BenchmarkConvolveFFT255(b *testing.B) {
+	benchmarkConvolve(b, 255, func(x, k []float64) []float64 { return dsp.Convolve(x, k, dsp.BoundaryZero) })
+}
+
+// gainDB returns the gain of kernel at freq in dB.
+func gainDB(kernel []float64, sampleRate int, freq float64) float64 {
+	return 20 * math.Log10(dsp.MagnitudeResponse(kernel, sampleRate, []float64{freq})[0])
+}
+
+// checkBands asserts that the gain stays within rippleDB of 0 dB across
+// each passband and below -attenuation across each stopband.
+func checkBands(t *testing.T, name string, kernel []float64, sampleRate int, pass, stop [][2]float64, rippleDB, attenuation float64) {
+	t.Helper()
+	for _, band := range pass {
+		for f := band[0]; f <= band[1]; f += (band[1] - band[0]) / 50 {
+			if g := gainDB(kernel, sampleRate, f); math.Abs(g) > rippleDB {
+				t.Errorf("%s: passband gain at %.0f Hz is %.3f dB", name, f, g)
+				return
+			}
+		}
+	}
+	for _, band := range stop {
+		for f := band[0]; f <= band[1]; f += (band[1] - band[0]) / 200 {
+			if g := gainDB(kernel, sampleRate, f); g > -attenuation {
+				t.Errorf("%s: stopband gain at %.0f Hz is %.1f dB", name, f, g)
+				return
+			}
+		}
+	}
+}
+
+func TestDesignKaiser(t *testing.T) {
+	const rate = 11025
+	tests := []struct {
+		name       string
+		spec       dsp.FilterSpec
+		pass, stop [][2]float64
+	}{
+		{
+			name: "low-pass",
+			spec: dsp.FilterSpec{Type: dsp.LowPass, Cutoff: 5000},
+			pass: [][2]float64{{0, 4900}},
+			stop: [][2]float64{{5100, rate / 2}},
+		},
+		{
+			name: "high-pass",
+			spec: dsp.FilterSpec{Type: dsp.HighPass, Cutoff: 300},
+			pass: [][2]float64{{400, rate / 2}},
+			stop: [][2]float64{{0, 200}},
+		},
+		{
+			name: "band-pass",
+			spec: dsp.FilterSpec{Type: dsp.BandPass, Low: 300, High: 5000},
+			pass: [][2]float64{{400, 4900}},
+			stop: [][2]float64{{0, 200}, {5100, rate / 2}},
+		},
+		{
+			name: "band-stop",
+			spec: dsp.FilterSpec{Type: dsp.BandStop, Low: 1000, High: 2000},
+			pass: [][2]float64{{0, 900}, {2100, rate / 2}},
+			stop: [][2]float64{{1100, 1900}},
+		},
+	}
+	for _, tc := range tests {
+		spec := tc.spec
+		spec.Transition, spec.Attenuation, spec.Ripple, spec.SampleRate = 200, 60, 0.01, rate
+		kernel, err := dsp.DesignKaiser(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(kernel)%2 != 1 {
+			t.Errorf("%s: expected an odd number of taps, got %d", tc.name, len(kernel))
+		}
+		checkBands(t, tc.name, kernel, rate, tc.pass, tc.stop, 0.01, 60)
+	}
+
+	for _, spec := range []dsp.FilterSpec{
+		{Type: dsp.LowPass, Cutoff: 6000, Transition: 100, Attenuation: 60, SampleRate: rate},
+		{Type: dsp.BandPass, Low: 2000, High: 1000, Transition: 100, Attenuation: 60, SampleRate: rate},
+		{Type: dsp.LowPass, Cutoff: 1000, Attenuation: 60, SampleRate: rate},
+	} {
+		if _, err := dsp.DesignKaiser(spec); err == nil {
+			t.Errorf("expected error for %+v", spec)
+		}
+	}
+}
+
+func TestKaiserOrder(t *testing.T) {
+	// Kaiser's formula for 60 dB and a transition of 1/100 of the sample
+	// rate gives (60-7.95)/(2.285*2*pi*0.01)+1 = 364 taps, made odd.
+	numTaps, beta := dsp.KaiserOrder(60, 441, 44100)
+	if numTaps != 365 {
+		t.Errorf("expected 365 taps, got %d", numTaps)
+	}
+	if !almostEqual(beta, 5.653, 1e-3) {
+		t.Errorf("expected beta 5.653, got %f", beta)
+	}
+}
+
+func TestHammingKernels(t *testing.T) {
+	const rate, taps = 44100, 201
+	highPass := dsp.GenerateHighPassKernel(1000, rate, taps)
+	bandPass := dsp.GenerateBandPassKernel(1000, 4000, rate, taps)
+	bandStop := dsp.GenerateBandStopKernel(1000, 4000, rate, taps)
+	// A 201-tap Hamming design has a transition of about 3.3*44100/201 Hz
+	// and about 53 dB of attenuation.
+	checkBands(t, "high-pass", highPass, rate, [][2]float64{{2000, 20000}}, [][2]float64{{0, 300}}, 0.05, 50)
+	checkBands(t, "band-pass", bandPass, rate, [][2]float64{{2000, 3000}}, [][2]float64{{0, 300}, {5000, 20000}}, 0.05, 50)
+	checkBands(t, "band-stop", bandStop, rate, [][2]float64{{0, 300}, {5000, 20000}}, [][2]float64{{2000, 3000}}, 0.05, 50)
+}
+
+func TestBiquadGains(t *testing.T) {
+	const rate = 44100
+	q := 1 / math.Sqrt2
+	db := func(g float64) float64 { return 20 * math.Log10(g) }
+	tests := []struct {
+		name   string
+		filter *dsp.Biquad
+		freq   float64
+		wantDB float64
+	}{
+		{"low-pass DC", dsp.NewLowPassBiquad(1000, q, rate), 0, 0},
+		{"low-pass corner", dsp.NewLowPassBiquad(1000, q, rate), 1000, -3.01},
+		{"high-pass corner", dsp.NewHighPassBiquad(1000, q, rate), 1000, -3.01},
+		{"high-pass Nyquist", dsp.NewHighPassBiquad(1000, q, rate), rate / 2, 0},
+		{"band-pass centre", dsp.NewBandPassBiquad(1000, 2, rate), 1000, 0},
+		{"peaking centre", dsp.NewPeakingBiquad(1000, 1, 6, rate), 1000, 6},
+		{"peaking far", dsp.NewPeakingBiquad(1000, 1, 6, rate), 15000, 0},
+		{"low shelf DC", dsp.NewLowShelfBiquad(500, -12, rate), 0, -12},
+		{"low shelf corner", dsp.NewLowShelfBiquad(500, -12, rate), 500, -6},
+		{"high shelf Nyquist", dsp.NewHighShelfBiquad(5000, 6, rate), rate / 2, 6},
+	}
+	for _, tc := range tests {
+		if got := db(tc.filter.Gain(tc.freq, rate)); !almostEqual(got, tc.wantDB, 0.05) {
+			t.Errorf("%s: expected %.2f dB, got %.2f dB", tc.name, tc.wantDB, got)
+		}
+	}
+	if g := dsp.NewNotchBiquad(50, 10, rate).Gain(50, rate); g > 1e-9 {
+		t.Errorf("notch: expected no gain at 50 Hz, got %g", g)
+	}
+}
+
+// Test that filtering in chunks matches filtering at once, and that the
+// measured response of a sine matches Gain.
+func TestFiltersStreaming(t *testing.T) {
+	const rate = 11025
+	butterworth, err := dsp.NewButterworth(dsp.LowPass, 1000, 5, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := map[string]func() dsp.Filter{
+		"biquad":      func() dsp.Filter { return dsp.NewPeakingBiquad(2000, 2, -9, rate) },
+		"cascade":     func() dsp.Filter { return butterworth },
+		"dc blocker":  func() dsp.Filter { return dsp.NewDCBlocker(20, rate) },
+		"preemphasis": func() dsp.Filter { return dsp.NewPreEmphasis(0.97) },
+		"convolver":   func() dsp.Filter { return dsp.NewConvolver(dsp.GenerateLowPassKernel(1000, rate, 51)) },
+	}
+	rng := rand.New(rand.NewSource(3))
+	input := randomSignal(rng, 4000)
+	for name, newFilter := range filters {
+		f := newFilter()
+		f.Reset()
+		whole := f.Process(input)
+		f.Reset()
+		var chunked []float64
+		for rest := input; len(rest) > 0; {
+			n := min(len(rest), 1+rng.Intn(300))
+			chunked = append(chunked, f.Process(rest[:n])...)
+			rest = rest[n:]
+		}
+		if !slicesAlmostEqual(whole, chunked, 1e-9) {
+			t.Errorf("%s: chunked output differs", name)
+		}
+	}
+
+	for _, freq := range []float64{300, 1000, 2000} {
+		butterworth.Reset()
+		want := butterworth.Gain(freq, rate) * math.Sqrt2 / 2
+		if got := rms(butterworth.Process(tone(freq, rate, 1)), 2000); !almostEqual(got, want, 0.005) {
+			t.Errorf("butterworth at %.0f Hz: expected RMS %f, got %f", freq, want, got)
+		}
+	}
+	if g := butterworth.Gain(1000, rate); !almostEqual(g, math.Sqrt2/2, 1e-6) {
+		t.Errorf("butterworth: expected -3 dB at the corner, got gain %f", g)
+	}
+	if g := butterworth.Gain(2000, rate); 20*math.Log10(g) > -30 {
+		t.Errorf("butterworth: expected 5th-order rolloff at 2 kHz, got %.1f dB", 20*math.Log10(g))
+	}
+	if _, err := dsp.NewButterworth(dsp.BandPass, 1000, 4, rate); err == nil {
+		t.Error("expected error for a band-pass Butterworth")
+	}
+}
+
+func TestDCBlocker(t *testing.T) {
+	input := tone(440, 11025, 1)
+	for i := range input {
+		input[i] += 0.5
+	}
+	output := dsp.NewDCBlocker(20, 11025).Process(input)
+	mean := 0.0
+	for _, v := range output[5000:] {
+		mean += v
+	}
+	mean /= float64(len(output) - 5000)
+	if math.Abs(mean) > 5e-3 {
+		t.Errorf("expected the offset to be removed, got mean %f", mean)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	// The Hamming window is the one GenerateLowPassKernel always used.
+	hamming := dsp.HammingWindow(101)
+	for i, w := range hamming {
+		if want := 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/100); w != want {
+			t.Fatalf("hamming[%d]: expected %v, got %v", i, want, w)
+		}
+	}
+
+	windows := map[string][]float64{
+		"hamming":         hamming,
+		"hann":            dsp.HannWindow(101),
+		"blackman":        dsp.BlackmanWindow(101),
+		"blackman-harris": dsp.BlackmanHarrisWindow(101),
+		"kaiser":          dsp.KaiserWindow(101, 8),
+		"flat-top":        dsp.FlatTopWindow(101),
+	}
+	for name, window := range windows {
+		if !almostEqual(window[50], 1, 1e-3) {
+			t.Errorf("%s: expected a peak of 1 in the middle, got %f", name, window[50])
+		}
+		for i := range window {
+			if !almostEqual(window[i], window[len(window)-1-i], 1e-12) {
+				t.Errorf("%s: not symmetric at %d", name, i)
+				break
+			}
+		}
+	}
+	if hann := windows["hann"]; !almostEqual(hann[0], 0, 1e-12) {
+		t.Errorf("expected the Hann window to start at 0, got %f", hann[0])
+	}
+	for i, w := range dsp.KaiserWindow(16, 0) {
+		if !almostEqual(w, 1, 1e-12) {
+			t.Errorf("expected a rectangular Kaiser window for beta 0, got %f at %d", w, i)
+		}
+	}
+	if w := dsp.HannWindow(1); len(w) != 1 || w[0] != 1 {
+		t.Errorf("expected [1] for a single point, got %v", w)
+	}
+}
+
+func TestWindowCoefficients(t *testing.T) {
+	a, err := dsp.Window{Type: dsp.WindowBlackman}.Coefficients(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := dsp.Window{Type: dsp.WindowBlackman, Beta: 3}.Coefficients(256)
+	if &a[0] != &b[0] {
+		t.Error("expected the cached window to be reused")
+	}
+	if !slicesAlmostEqual(a, dsp.BlackmanWindow(256), 1e-15) {
+		t.Error("expected the cached window to equal BlackmanWindow")
+	}
+
+	k5, _ := dsp.Window{Type: dsp.WindowKaiser, Beta: 5}.Coefficients(256)
+	k9, _ := dsp.Window{Type: dsp.WindowKaiser, Beta: 9}.Coefficients(256)
+	if k5[10] == k9[10] {
+		t.Error("expected Kaiser windows with different beta to be cached apart")
+	}
+
+	if _, err := (dsp.Window{Type: dsp.WindowType(99)}).Coefficients(256); err == nil {
+		t.Error("expected error for an unknown window type")
+	}
+	if _, err := (dsp.Window{Type: dsp.WindowKaiser, Beta: -1}).Coefficients(256); err == nil {
+		t.Error("expected error for a negative Kaiser beta")
+	}
+	if _, err := (dsp.Window{}).Coefficients(0); err == nil {
+		t.Error("expected error for an empty window")
+	}
+}
+
+func TestFlatTopAmplitude(t *testing.T) {
+	// A tone half-way between bins loses about 1.4 dB with a Hann window
+	// but keeps its amplitude with a flat-top window.
+	const n = 1024
+	peak := func(window []float64, bin float64) float64 {
+		frame := make([]float64, n)
+		for i := range frame {
+			frame[i] = math.Sin(2*math.Pi*bin*float64(i)/n) * window[i]
+		}
+		spectrum := dsp.ComputeFFT(frame)
+		best := 0.0
+		for _, m := range spectrum {
+			best = max(best, m)
+		}
+		return best
+	}
+	for _, tc := range []struct {
+		name   string
+		window []float64
+		maxDB  float64
+	}{
+		{"flat-top", dsp.FlatTopWindow(n), 0.01},
+		{"hann", dsp.HannWindow(n), 2},
+	} {
+		loss := 20 * math.Log10(peak(tc.window, 100)/peak(tc.window, 100.5))
+		if loss < 0 || loss > tc.maxDB {
+			t.Errorf("%s: expected a scalloping loss under %.2f dB, got %.3f dB", tc.name, tc.maxDB, loss)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	signal := []float64{1, 2, 3, 4, 5, 6, 7}
+
+	none, err := dsp.Frame(signal, 4, 2, dsp.PadNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 2 || none[1][0] != 3 {
+		t.Errorf("expected 2 complete frames starting at 1 and 3, got %v", none)
+	}
+
+	// Frames are centred on samples 0, 2, 4 and 6.
+	centre, err := dsp.Frame(signal, 4, 2, dsp.PadCentre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{0, 0, 1, 2}, {1, 2, 3, 4}, {3, 4, 5, 6}, {5, 6, 7, 0}}
+	if len(centre) != len(want) {
+		t.Fatalf("expected %d frames, got %d", len(want), len(centre))
+	}
+	for i := range want {
+		if !slicesAlmostEqual(centre[i], want[i], 1e-12) {
+			t.Errorf("centre frame %d: expected %v, got %v", i, want[i], centre[i])
+		}
+	}
+
+	reflect, err := dsp.Frame(signal, 4, 2, dsp.PadReflect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slicesAlmostEqual(reflect[0], []float64{3, 2, 1, 2}, 1e-12) || !slicesAlmostEqual(reflect[3], []float64{5, 6, 7, 6}, 1e-12) {
+		t.Errorf("expected mirrored edges, got %v and %v", reflect[0], reflect[3])
+	}
+
+	for _, size := range [][2]int{{4, 0}, {4, -1}, {0, 2}} {
+		if _, err := dsp.Frame(signal, size[0], size[1], dsp.PadNone); err == nil {
+			t.Errorf("expected error for frame size %d and hop size %d", size[0], size[1])
+		}
+	}
+}
+
+func TestSTFT(t *testing.T) {
+	signal := tone(440, 8000, 0.5)
+	spec := dsp.STFTSpec{FrameSize: 256, HopSize: 128}
+	frames, err := dsp.STFT(signal, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 30 || len(frames[0]) != 129 {
+		t.Fatalf("expected 30 frames of 129 bins, got %d of %d", len(frames), len(frames[0]))
+	}
+
+	// The magnitudes are those of ComputeFFT on the windowed frame.
+	frame := append([]float64(nil), signal[128:384]...)
+	for i, w := range dsp.HammingWindow(256) {
+		frame[i] *= w
+	}
+	magnitudes := dsp.ComputeFFT(frame)
+	for k, c := range frames[1] {
+		if !almostEqual(cmplx.Abs(c), magnitudes[k], 1e-9) {
+			t.Fatalf("bin %d: expected magnitude %f, got %f", k, magnitudes[k], cmplx.Abs(c))
+		}
+	}
+
+	for _, spec := range []dsp.STFTSpec{
+		{FrameSize: 256, HopSize: 300},
+		{FrameSize: 256, HopSize: 0},
+		{FrameSize: 256, HopSize: 64, Padding: dsp.Padding(9)},
+		{FrameSize: 256, HopSize: 64, Window: dsp.Window{Type: dsp.WindowType(9)}},
+	} {
+		if _, err := dsp.STFT(signal, spec); err == nil {
+			t.Errorf("expected error for %+v", spec)
+		}
+	}
+}
+
+func TestISTFT(t *testing.T) {
+	signal := randomSignal(rand.New(rand.NewSource(7)), 3001)
+	for _, spec := range []dsp.STFTSpec{
+		{FrameSize: 256, HopSize: 128},
+		{FrameSize: 256, HopSize: 64, Window: dsp.Window{Type: dsp.WindowHann}, Padding: dsp.PadCentre},
+		{FrameSize: 512, HopSize: 100, Window: dsp.Window{Type: dsp.WindowBlackman}, Padding: dsp.PadReflect},
+	} {
+		frames, err := dsp.STFT(signal, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dsp.ISTFT(frames, spec, len(signal))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(signal) {
+			t.Fatalf("%+v: expected %d samples, got %d", spec, len(signal), len(got))
+		}
+		// Without padding the samples after the last complete frame are lost.
+		end := len(signal)
+		if spec.Padding == dsp.PadNone {
+			end = (len(frames)-1)*spec.HopSize + spec.FrameSize
+		}
+		if !slicesAlmostEqual(got[:end], signal[:end], 1e-9) {
+			t.Errorf("%+v: expected the signal back", spec)
+		}
+		for i := end; i < len(got); i++ {
+			if got[i] != 0 {
+				t.Errorf("%+v: expected zeros after the last frame, got %f at %d", spec, got[i], i)
+				break
+			}
+		}
+	}
+
+	spec := dsp.STFTSpec{FrameSize: 256, HopSize: 128}
+	if _, err := dsp.ISTFT([][]complex128{make([]complex128, 10)}, spec, 0); err == nil {
+		t.Error("expected error for a frame of the wrong size")
+	}
+}
+
+func TestScales(t *testing.T) {
+	if mel := dsp.HzToMel(1000); !almostEqual(mel, 1000, 0.1) {
+		t.Errorf("expected 1000 Hz at about 1000 mel, got %f", mel)
+	}
+	if bark := dsp.HzToBark(1000); !almostEqual(bark, 8.5, 0.1) {
+		t.Errorf("expected 1000 Hz at about 8.5 Bark, got %f", bark)
+	}
+	for _, f := range []float64{0, 100, 440, 3000, 5512.5} {
+		if got := dsp.MelToHz(dsp.HzToMel(f)); !almostEqual(got, f, 1e-9) {
+			t.Errorf("mel round trip of %f Hz gave %f", f, got)
+		}
+		if got := dsp.BarkToHz(dsp.HzToBark(f)); !almostEqual(got, f, 1e-9) {
+			t.Errorf("Bark round trip of %f Hz gave %f", f, got)
+		}
+	}
+
+	edges, err := dsp.BandEdges(dsp.ScaleLog, 100, 6400, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{100, 200, 400, 800, 1600, 3200, 6400} {
+		if !almostEqual(edges[i], want, 1e-9) {
+			t.Errorf("log edge %d: expected %f, got %f", i, want, edges[i])
+		}
+	}
+	edges, _ = dsp.BandEdges(dsp.ScaleMel, 0, 5512.5, 6)
+	for i := 1; i < len(edges); i++ {
+		step := dsp.HzToMel(edges[i]) - dsp.HzToMel(edges[i-1])
+		if !almostEqual(step, dsp.HzToMel(5512.5)/6, 1e-6) {
+			t.Errorf("mel band %d: expected equal mel width, got %f", i, step)
+		}
+	}
+
+	for _, tc := range []struct {
+		scale     dsp.Scale
+		low, high float64
+		bands     int
+	}{
+		{dsp.ScaleLog, 0, 1000, 4},
+		{dsp.ScaleMel, 500, 100, 4},
+		{dsp.ScaleMel, 0, 1000, 0},
+		{dsp.Scale(9), 0, 1000, 4},
+	} {
+		if _, err := dsp.BandEdges(tc.scale, tc.low, tc.high, tc.bands); err == nil {
+			t.Errorf("expected error for %+v", tc)
+		}
+	}
+}
+
+func TestFilterbank(t *testing.T) {
+	const frameSize, sampleRate = 1024, 11025
+	for _, scale := range []dsp.Scale{dsp.ScaleLinear, dsp.ScaleMel, dsp.ScaleBark, dsp.ScaleLog} {
+		fb, err := dsp.NewFilterbank(scale, 24, 50, 5000, frameSize, sampleRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fb.Centres) != 24 {
+			t.Fatalf("scale %d: expected 24 centres, got %d", scale, len(fb.Centres))
+		}
+		// A tone at the centre of a band gives that band the most energy.
+		for _, band := range []int{3, 12, 20} {
+			frame := tone(fb.Centres[band], sampleRate, float64(frameSize)/sampleRate)
+			for i, w := range dsp.HannWindow(frameSize) {
+				frame[i] *= w
+			}
+			energies := fb.Apply(dsp.ComputeFFT(frame))
+			best := 0
+			for b, e := range energies {
+				if e > energies[best] {
+					best = b
+				}
+			}
+			if best != band {
+				t.Errorf("scale %d: expected a %.0f Hz tone in band %d, got band %d", scale, fb.Centres[band], band, best)
+			}
+		}
+	}
+
+	if _, err := dsp.NewFilterbank(dsp.ScaleMel, 24, 0, 6000, frameSize, sampleRate); err == nil {
+		t.Error("expected error for a band above Nyquist")
+	}
+}
+
+func TestFrameRMS(t *testing.T) {
+	signal := tone(100, 8000, 1)
+	for i := 4000; i < 6000; i++ {
+		signal[i] = 0
+	}
+	rms, err := dsp.FrameRMS(signal, 400, 200, dsp.PadNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, _ := dsp.Frame(signal, 400, 200, dsp.PadNone)
+	if len(rms) != len(frames) {
+		t.Fatalf("expected one level per frame, got %d", len(rms))
+	}
+	if !almostEqual(rms[0], math.Sqrt(0.5), 1e-9) {
+		t.Errorf("expected a sine to have an RMS of 0.707, got %f", rms[0])
+	}
+	if rms[25] != 0 {
+		t.Errorf("expected silence to have an RMS of 0, got %f", rms[25])
+	}
+	energy, err := dsp.FrameEnergy(signal, 400, 200, dsp.PadNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !almostEqual(energy[0], 200, 1e-9) {
+		t.Errorf("expected an energy of 200, got %f", energy[0])
+	}
+	if _, err := dsp.FrameRMS(signal, 400, 0, dsp.PadCentre); err == nil {
+		t.Error("expected error for a zero hop size")
+	}
+	if _, err := dsp.FrameEnergy(signal, 0, 200, dsp.PadNone); err == nil {
+		t.Error("expected error for a zero frame size")
+	}
+
+	if db := dsp.AmplitudeToDB(0.1); !almostEqual(db, -20, 1e-9) {
+		t.Errorf("expected -20 dB, got %f", db)
+	}
+	if db := dsp.AmplitudeToDB(0); !math.IsInf(db, -1) {
+		t.Errorf("expected -Inf dB for silence, got %f", db)
+	}
+}
+
+func TestKWeighting(t *testing.T) {
+	// The coefficients tabulated in ITU-R BS.1770-4 for 48 kHz.
+	k := dsp.NewKWeighting(48000)
+	want := [][5]float64{
+		{1.53512485958697, -2.69169618940638, 1.19839281085285, -1.69065929318241, 0.73248077421585},
+		{1, -2, 1, -1.99004745483398, 0.99007225036621},
+	}
+	for i, b := range k {
+		got := [5]float64{b.B0, b.B1, b.B2, b.A1, b.A2}
+		for j := range got {
+			if !almostEqual(got[j], want[i][j], 1e-8) {
+				t.Errorf("stage %d coefficient %d: expected %.14f, got %.14f", i, j, want[i][j], got[j])
+			}
+		}
+	}
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	// A mono 997 Hz sine at -20 dBFS is -23 LUFS at any rate.
+	for _, rate := range []int{11025, 44100, 48000} {
+		signal := tone(997, rate, 5)
+		for i := range signal {
+			signal[i] *= 0.1
+		}
+		if got := dsp.IntegratedLoudness(signal, rate); !almostEqual(got, -23, 0.1) {
+			t.Errorf("%d Hz: expected -23 LUFS, got %.2f", rate, got)
+		}
+	}
+
+	// EBU Tech 3341 case 3: 10 s at -36, 60 s at -23 and 10 s at -36 LUFS.
+	// The relative gate drops the quiet parts.
+	const rate = 48000
+	var signal []float64
+	for _, part := range []struct{ seconds, lufs float64 }{{10, -36}, {60, -23}, {10, -36}} {
+		amplitude := math.Pow(10, (part.lufs+3.01)/20)
+		for _, x := range tone(1000, rate, part.seconds) {
+			signal = append(signal, amplitude*x)
+		}
+	}
+	if got := dsp.IntegratedLoudness(signal, rate); !almostEqual(got, -23, 0.1) {
+		t.Errorf("expected the quiet parts to be gated at -23 LUFS, got %.2f", got)
+	}
+
+	if got := dsp.IntegratedLoudness(make([]float64, rate), rate); !math.IsInf(got, -1) {
+		t.Errorf("expected -Inf for silence, got %f", got)
+	}
+	if got := dsp.IntegratedLoudness(tone(1000, rate, 0.3), rate); !math.IsInf(got, -1) {
+		t.Errorf("expected -Inf for a signal shorter than a block, got %f", got)
+	}
+}
+
+func TestResample32(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	for _, rate := range []int{22050, 44100, 44101, 192000} {
+		samples := make([]int16, rate/2)
+		for i := range samples {
+			samples[i] = int16(rng.Intn(65536) - 32768)
+		}
+		input := make([]float64, len(samples))
+		input32 := make([]float32, len(samples))
+		for i, s := range samples {
+			input[i] = float64(s) / 32768
+			input32[i] = float32(input[i])
+		}
+		r := dsp.NewMultiStageResampler(rate, 11025, 101)
+		want := r.Resample(input)
+		fromFloat, fromInt := r.Resample32(input32), r.ResampleInt16(samples)
+		if len(fromFloat) != len(want) || len(fromInt) != len(want) {
+			t.Fatalf("%d Hz: expected %d samples, got %d and %d", rate, len(want), len(fromFloat), len(fromInt))
+		}
+		for i := range want {
+			if fromFloat[i] != fromInt[i] || !almostEqual(float64(fromFloat[i]), want[i], 1e-6) {
+				t.Fatalf("%d Hz sample %d: expected %f, got %f and %f", rate, i, want[i], fromFloat[i], fromInt[i])
+			}
+		}
+	}
+}
+
+func TestMagnitudeSpectrogram32(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	signal := randomSignal(rng, 5000)
+	signal32 := make([]float32, len(signal))
+	for i, x := range signal {
+		signal32[i] = float32(x)
+		signal[i] = float64(signal32[i])
+	}
+	var pool dsp.Float32Pool
+	for _, padding := range []dsp.Padding{dsp.PadNone, dsp.PadCentre, dsp.PadReflect} {
+		spec := dsp.STFTSpec{FrameSize: 512, HopSize: 128, Window: dsp.Window{Type: dsp.WindowHann}, Padding: padding}
+		want, err := dsp.STFT(signal, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dsp.MagnitudeSpectrogram32(signal32, spec, &pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Frames != len(want) || got.Bins != 257 || len(got.Data) != got.Frames*got.Bins {
+			t.Fatalf("padding %d: expected %d frames of 257 bins, got %d of %d in %d values", padding, len(want), got.Frames, got.Bins, len(got.Data))
+		}
+		for i, frame := range got.Float64() {
+			for k, v := range frame {
+				if w := cmplx.Abs(want[i][k]); math.Abs(v-w) > 1e-7*max(w, 1) {
+					t.Fatalf("padding %d frame %d bin %d: expected %f, got %f", padding, i, k, w, v)
+				}
+			}
+		}
+
+		rms, _ := dsp.FrameRMS(signal, 512, 128, padding)
+		rms32, err := dsp.FrameRMS32(signal32, 512, 128, padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slicesAlmostEqual(rms, rms32, 1e-15) {
+			t.Errorf("padding %d: expected FrameRMS32 to match FrameRMS", padding)
+		}
+		pool.Put(got.Data)
+	}
+
+	if _, err := dsp.MagnitudeSpectrogram32(signal32, dsp.STFTSpec{FrameSize: 512, HopSize: 0}, nil); err == nil {
+		t.Error("expected error for a zero hop size")
+	}
+	if _, err := dsp.FrameRMS32(signal32, 512, 0, dsp.PadCentre); err == nil {
+		t.Error("expected FrameRMS32 to reject a zero hop size")
+	}
+	short, err := dsp.MagnitudeSpectrogram32(signal32[:100], dsp.STFTSpec{FrameSize: 512, HopSize: 128}, nil)
+	if err != nil || short.Frames != 0 || len(short.Data) != 0 {
+		t.Errorf("expected no frames from a signal shorter than a frame, got %+v, %v", short, err)
+	}
+}
+
+func TestFloat32Pool(t *testing.T) {
+	var pool dsp.Float32Pool
+	buf := pool.Get(100)
+	if len(buf) != 100 {
+		t.Fatalf("expected 100 values, got %d", len(buf))
+	}
+	buf[0] = 1
+	pool.Put(buf)
+	// A pool may drop buffers, so only the lengths are checked.
+	if got := pool.Get(50); len(got) != 50 {
+		t.Errorf("expected a recycled buffer of 50 values, got %d", len(got))
+	}
+	if got := pool.Get(1000); len(got) != 1000 {
+		t.Errorf("expected a new buffer of 1000 values, got %d", len(got))
+	}
+
+	var none *dsp.Float32Pool
+	none.Put(buf)
+	if got := none.Get(10); len(got) != 10 {
+		t.Errorf("expected a nil pool to allocate, got %d values", len(got))
+	}
+}
+
+func TestMagnitudeFrames(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	signal := randomSignal(rng, 3000)
+	for _, padding := range []dsp.Padding{dsp.PadNone, dsp.PadReflect} {
+		spec := dsp.STFTSpec{FrameSize: 256, HopSize: 64, Padding: padding}
+		want, err := dsp.STFT(signal, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([][]float64, len(want))
+		err = dsp.MagnitudeFrames(signal, spec, func(i int, magnitudes []float64) {
+			if got[i] != nil {
+				t.Errorf("padding %d: frame %d computed twice", padding, i)
+			}
+			got[i] = append([]float64(nil), magnitudes...)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, frame := range want {
+			for k, c := range frame {
+				if got[i] == nil || got[i][k] != cmplx.Abs(c) {
+					t.Fatalf("padding %d frame %d bin %d: expected %f, got %v", padding, i, k, cmplx.Abs(c), got[i])
+				}
+			}
+		}
+	}
+	if err := dsp.MagnitudeFrames(signal, dsp.STFTSpec{FrameSize: 256}, func(int, []float64) {}); err == nil {
+		t.Error("expected error for a zero hop size")
+	}
+}
@@ -0,0 +1,37 @@
+package dsp
+
+import "math"
+
+// FrameEnergy returns the sum of squared samples of every frame of signal,
+// framed like Frame so the values line up with an STFT of the same frames.
+func FrameEnergy(signal []float64, frameSize, hopSize int, padding Padding) ([]float64, error) {
+	frames, err := Frame(signal, frameSize, hopSize, padding)
+	if err != nil {
+		return nil, err
+	}
+	energies := make([]float64, len(frames))
+	for t, frame := range frames {
+		for _, x := range frame {
+			energies[t] += x * x
+		}
+	}
+	return energies, nil
+}
+
+// FrameRMS returns the root mean square amplitude of every frame of signal.
+func FrameRMS(signal []float64, frameSize, hopSize int, padding Padding) ([]float64, error) {
+	rms, err := FrameEnergy(signal, frameSize, hopSize, padding)
+	if err != nil {
+		return nil, err
+	}
+	for t, e := range rms {
+		rms[t] = math.Sqrt(e / float64(frameSize))
+	}
+	return rms, nil
+}
+
+// AmplitudeToDB converts an amplitude to decibels relative to full scale
+// (an amplitude of 1). Zero is minus infinity.
+func AmplitudeToDB(amplitude float64) float64 {
+	return 20 * math.Log10(amplitude)
+}
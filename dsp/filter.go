@@ -1,6 +1,8 @@
 package dsp
 
 import (
+	"errors"
+	"fmt"
 	"math"
 )
 
@@ -13,6 +15,7 @@ func GenerateLowPassKernel(cutoffFreq float64, sampleRate int, numTaps int) []fl
 	kernel := make([]float64, numTaps)
 	fc := cutoffFreq / float64(sampleRate)
 	m := float64(numTaps - 1)
+	window := HammingWindow(numTaps)
 
 	for i := 0; i < numTaps; i++ {
 		n := float64(i)
@@ -21,7 +24,7 @@ func GenerateLowPassKernel(cutoffFreq float64, sampleRate int, numTaps int) []fl
 		} else {
 			kernel[i] = math.Sin(2*math.Pi*fc*(n-m/2)) / (math.Pi * (n - m/2))
 		}
-		kernel[i] *= 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/m)
+		kernel[i] *= window[i]
 	}
 
 	sum := 0.0
@@ -35,24 +38,177 @@ func GenerateLowPassKernel(cutoffFreq float64, sampleRate int, numTaps int) []fl
 }
 
 // ApplyFIRFilter applies an FIR filter to the input signal using the provided kernel.
+// Samples outside the input are treated as zero; it is Convolve with
+// BoundaryZero, so long kernels are applied by FFT.
 func ApplyFIRFilter(input []float64, kernel []float64) []float64 {
-	n := len(input)
-	k := len(kernel)
-	output := make([]float64, n)
-	half := k / 2
-	for i := 0; i < n; i++ {
-		acc := 0.0
-		for j := 0; j < k; j++ {
-			idx := i + j - half
-			if idx < 0 {
-				continue
-			}
-			if idx >= n {
-				break
-			}
-			acc += input[idx] * kernel[j]
+	return Convolve(input, kernel, BoundaryZero)
+}
+
+// GenerateHighPassKernel creates a high-pass FIR filter kernel by spectral
+// inversion of the Hamming low-pass kernel with the same cutoff, so its
+// gain is exactly zero at DC. numTaps must be odd.
+func GenerateHighPassKernel(cutoffFreq float64, sampleRate int, numTaps int) []float64 {
+	return invertKernel(GenerateLowPassKernel(cutoffFreq, sampleRate, numTaps))
+}
+
+// GenerateBandPassKernel creates a band-pass FIR filter kernel passing
+// lowFreq to highFreq Hz, as the difference of two Hamming low-pass
+// kernels. numTaps must be odd.
+func GenerateBandPassKernel(lowFreq, highFreq float64, sampleRate int, numTaps int) []float64 {
+	return subtractKernels(
+		GenerateLowPassKernel(highFreq, sampleRate, numTaps),
+		GenerateLowPassKernel(lowFreq, sampleRate, numTaps))
+}
+
+// GenerateBandStopKernel creates a band-stop FIR filter kernel rejecting
+// lowFreq to highFreq Hz. numTaps must be odd.
+func GenerateBandStopKernel(lowFreq, highFreq float64, sampleRate int, numTaps int) []float64 {
+	return invertKernel(GenerateBandPassKernel(lowFreq, highFreq, sampleRate, numTaps))
+}
+
+// FilterType selects the response of a designed filter.
+type FilterType int
+
+const (
+	LowPass FilterType = iota
+	HighPass
+	BandPass
+	BandStop
+)
+
+// FilterSpec specifies a Kaiser-window FIR filter. Cutoffs are the middle
+// of their transition bands, where the gain is -6 dB.
+type FilterSpec struct {
+	Type        FilterType
+	Cutoff      float64 // LowPass and HighPass cutoff in Hz.
+	Low, High   float64 // BandPass and BandStop band edges in Hz.
+	Transition  float64 // Width of each transition band in Hz.
+	Attenuation float64 // Minimum stopband attenuation in dB.
+	Ripple      float64 // Maximum passband ripple in dB; 0 leaves it to Attenuation.
+	SampleRate  int
+}
+
+// KaiserOrder returns the odd number of taps and the Kaiser window β that
+// reach attenuation dB with a transition band of the given width, using
+// Kaiser's empirical formulas.
+func KaiserOrder(attenuation, transition float64, sampleRate int) (int, float64) {
+	var beta float64
+	switch {
+	case attenuation > 50:
+		beta = 0.1102 * (attenuation - 8.7)
+	case attenuation > 21:
+		beta = 0.5842*math.Pow(attenuation-21, 0.4) + 0.07886*(attenuation-21)
+	}
+	width := 2 * math.Pi * transition / float64(sampleRate)
+	numTaps := int(math.Ceil((attenuation-7.95)/(2.285*width))) + 1
+	if numTaps%2 == 0 {
+		numTaps++
+	}
+	return max(numTaps, 3), beta
+}
+
+// DesignKaiser designs a filter to spec with a Kaiser-windowed sinc. The
+// window has the same ripple in the passband and the stopband, so the
+// tighter of Attenuation and Ripple sets the length.
+func DesignKaiser(spec FilterSpec) ([]float64, error) {
+	nyquist := float64(spec.SampleRate) / 2
+	if spec.SampleRate <= 0 || spec.Transition <= 0 {
+		return nil, errors.New("sample rate and transition width must be positive")
+	}
+	if spec.Attenuation <= 0 && spec.Ripple <= 0 {
+		return nil, errors.New("attenuation or ripple must be positive")
+	}
+	inBand := func(f float64) bool { return f > 0 && f < nyquist }
+	switch spec.Type {
+	case LowPass, HighPass:
+		if !inBand(spec.Cutoff) {
+			return nil, fmt.Errorf("cutoff %g Hz outside (0, %g)", spec.Cutoff, nyquist)
+		}
+	case BandPass, BandStop:
+		if !inBand(spec.Low) || !inBand(spec.High) || spec.Low >= spec.High {
+			return nil, fmt.Errorf("band %g-%g Hz invalid for Nyquist %g", spec.Low, spec.High, nyquist)
 		}
-		output[i] = acc
+	default:
+		return nil, fmt.Errorf("unknown filter type %d", spec.Type)
+	}
+
+	attenuation := spec.Attenuation
+	if spec.Ripple > 0 {
+		g := math.Pow(10, spec.Ripple/20)
+		attenuation = max(attenuation, -20*math.Log10((g-1)/(g+1)))
+	}
+	numTaps, beta := KaiserOrder(attenuation, spec.Transition, spec.SampleRate)
+	window := KaiserWindow(numTaps, beta)
+	lowPass := func(cutoff float64) []float64 {
+		return windowedSinc(cutoff, spec.SampleRate, window)
+	}
+
+	switch spec.Type {
+	case LowPass:
+		return lowPass(spec.Cutoff), nil
+	case HighPass:
+		return invertKernel(lowPass(spec.Cutoff)), nil
+	case BandPass:
+		return subtractKernels(lowPass(spec.High), lowPass(spec.Low)), nil
+	default:
+		return invertKernel(subtractKernels(lowPass(spec.High), lowPass(spec.Low))), nil
+	}
+}
+
+// MagnitudeResponse returns the gain of kernel at each frequency in Hz,
+// as a linear factor. 20*log10 of it gives the gain in dB.
+func MagnitudeResponse(kernel []float64, sampleRate int, freqs []float64) []float64 {
+	gains := make([]float64, len(freqs))
+	for i, f := range freqs {
+		w := 2 * math.Pi * f / float64(sampleRate)
+		var re, im float64
+		for n, v := range kernel {
+			re += v * math.Cos(w*float64(n))
+			im -= v * math.Sin(w*float64(n))
+		}
+		gains[i] = math.Hypot(re, im)
+	}
+	return gains
+}
+
+// windowedSinc returns a low-pass kernel of len(window) taps with unit
+// gain at DC.
+func windowedSinc(cutoffFreq float64, sampleRate int, window []float64) []float64 {
+	kernel := make([]float64, len(window))
+	fc := cutoffFreq / float64(sampleRate)
+	m := float64(len(window)-1) / 2
+	sum := 0.0
+	for i := range kernel {
+		x := float64(i) - m
+		if x == 0 {
+			kernel[i] = 2 * fc
+		} else {
+			kernel[i] = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		kernel[i] *= window[i]
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// invertKernel turns a unit-DC-gain low-pass kernel into the complementary
+// high-pass kernel: a unit impulse minus the low-pass.
+func invertKernel(kernel []float64) []float64 {
+	out := make([]float64, len(kernel))
+	for i, v := range kernel {
+		out[i] = -v
+	}
+	out[len(out)/2] += 1
+	return out
+}
+
+func subtractKernels(a, b []float64) []float64 {
+	out := make([]float64, len(a))
+	for i := range a {
+		out[i] = a[i] - b[i]
 	}
-	return output
+	return out
 }
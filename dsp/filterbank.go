@@ -0,0 +1,146 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Scale is a frequency scale on which bands are spaced evenly.
+type Scale int
+
+const (
+	// ScaleLinear spaces bands evenly in Hz.
+	ScaleLinear Scale = iota
+	// ScaleMel spaces bands evenly in mel, matching perceived pitch:
+	// roughly linear below 1 kHz and logarithmic above.
+	ScaleMel
+	// ScaleBark spaces bands evenly in Bark, the critical bands of
+	// hearing.
+	ScaleBark
+	// ScaleLog spaces bands by a constant frequency ratio, so every band
+	// has the same Q, like a constant-Q transform.
+	ScaleLog
+)
+
+// HzToMel converts a frequency to mel with the HTK formula.
+func HzToMel(freq float64) float64 {
+	return 2595 * math.Log10(1+freq/700)
+}
+
+// MelToHz converts mel to a frequency in Hz.
+func MelToHz(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
+
+// HzToBark converts a frequency to Bark with Traunmüller's formula.
+func HzToBark(freq float64) float64 {
+	return 26.81*freq/(1960+freq) - 0.53
+}
+
+// BarkToHz converts Bark to a frequency in Hz.
+func BarkToHz(bark float64) float64 {
+	return 1960 * (bark + 0.53) / (26.28 - bark)
+}
+
+// BandEdges returns numBands+1 frequencies in Hz from low to high, spaced
+// evenly on scale. ScaleLog needs a positive low edge.
+func BandEdges(scale Scale, low, high float64, numBands int) ([]float64, error) {
+	if numBands < 1 {
+		return nil, fmt.Errorf("number of bands %d must be positive", numBands)
+	}
+	if low < 0 || low >= high {
+		return nil, fmt.Errorf("band %g-%g Hz is invalid", low, high)
+	}
+
+	var to, from func(float64) float64
+	switch scale {
+	case ScaleLinear:
+		to, from = func(f float64) float64 { return f }, func(f float64) float64 { return f }
+	case ScaleMel:
+		to, from = HzToMel, MelToHz
+	case ScaleBark:
+		to, from = HzToBark, BarkToHz
+	case ScaleLog:
+		if low == 0 {
+			return nil, fmt.Errorf("log-spaced bands need a positive low edge")
+		}
+		to, from = math.Log, math.Exp
+	default:
+		return nil, fmt.Errorf("unknown frequency scale %d", scale)
+	}
+
+	edges := make([]float64, numBands+1)
+	lo, hi := to(low), to(high)
+	for i := range edges {
+		edges[i] = from(lo + (hi-lo)*float64(i)/float64(numBands))
+	}
+	// Pin the ends against rounding in the conversions.
+	edges[0], edges[numBands] = low, high
+	return edges, nil
+}
+
+// Filterbank maps a magnitude spectrum onto bands spaced on a frequency
+// scale, with overlapping triangular filters of unit peak.
+type Filterbank struct {
+	Centres []float64 // Centre frequency of each band in Hz.
+	starts  []int     // First bin of each filter.
+	weights [][]float64
+}
+
+// NewFilterbank returns numBands triangular filters for the spectrum of
+// frameSize samples at sampleRate, as returned by ComputeFFT. The filters
+// are centred at evenly spaced points of scale between low and high, and
+// each one falls to zero at the centres of its neighbours. A filter
+// narrower than one bin takes the bin nearest its centre.
+func NewFilterbank(scale Scale, numBands int, low, high float64, frameSize, sampleRate int) (*Filterbank, error) {
+	nyquist := float64(sampleRate) / 2
+	if high > nyquist {
+		return nil, fmt.Errorf("band edge %g Hz above Nyquist %g", high, nyquist)
+	}
+	points, err := BandEdges(scale, low, high, numBands+1)
+	if err != nil {
+		return nil, err
+	}
+
+	binWidth := float64(sampleRate) / float64(frameSize)
+	numBins := frameSize/2 + 1
+	fb := &Filterbank{
+		Centres: points[1 : numBands+1],
+		starts:  make([]int, numBands),
+		weights: make([][]float64, numBands),
+	}
+	for b := range numBands {
+		left, centre, right := points[b], points[b+1], points[b+2]
+		first := max(int(math.Ceil(left/binWidth)), 0)
+		last := min(int(math.Floor(right/binWidth)), numBins-1)
+		var weights []float64
+		for k := first; k <= last; k++ {
+			f := float64(k) * binWidth
+			w := (f - left) / (centre - left)
+			if f > centre {
+				w = (right - f) / (right - centre)
+			}
+			weights = append(weights, max(w, 0))
+		}
+		if !slices.ContainsFunc(weights, func(w float64) bool { return w > 0 }) {
+			first = min(int(math.Round(centre/binWidth)), numBins-1)
+			weights = []float64{1}
+		}
+		fb.starts[b], fb.weights[b] = first, weights
+	}
+	return fb, nil
+}
+
+// Apply returns the weighted sum of the spectrum in each band.
+func (fb *Filterbank) Apply(spectrum []float64) []float64 {
+	out := make([]float64, len(fb.weights))
+	for b, weights := range fb.weights {
+		for i, w := range weights {
+			if k := fb.starts[b] + i; k < len(spectrum) {
+				out[b] += w * spectrum[k]
+			}
+		}
+	}
+	return out
+}
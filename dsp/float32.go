@@ -0,0 +1,103 @@
+package dsp
+
+import (
+	"math"
+	"sync"
+)
+
+// Float32Pool recycles float32 buffers, such as the storage of a
+// Spectrogram32, between recordings. Bulk ingestion of tracks of similar
+// length then allocates its largest buffers only once. The zero value is
+// ready to use and a nil pool allocates every buffer.
+type Float32Pool struct {
+	pool sync.Pool
+}
+
+// Get returns a buffer of length n with undefined contents. A recycled
+// buffer that is too small is dropped and a new one allocated.
+func (p *Float32Pool) Get(n int) []float32 {
+	if p != nil {
+		if buf, ok := p.pool.Get().(*[]float32); ok && cap(*buf) >= n {
+			return (*buf)[:n]
+		}
+	}
+	return make([]float32, n)
+}
+
+// Put returns a buffer to the pool. It must not be used afterwards.
+func (p *Float32Pool) Put(buf []float32) {
+	if p == nil || cap(buf) == 0 {
+		return
+	}
+	buf = buf[:0]
+	p.pool.Put(&buf)
+}
+
+// Spectrogram32 is a magnitude spectrogram stored in one contiguous float32
+// slice, frame after frame, at half the size of [][]float64 and without a
+// slice header and allocation per frame.
+type Spectrogram32 struct {
+	Data   []float32 // Frames*Bins magnitudes.
+	Frames int       // Number of frames.
+	Bins   int       // Bins per frame, the stride of Data.
+}
+
+// Frame returns the magnitudes of frame t, sharing Data.
+func (s *Spectrogram32) Frame(t int) []float32 {
+	return s.Data[t*s.Bins : (t+1)*s.Bins : (t+1)*s.Bins]
+}
+
+// Float64 copies the spectrogram into the [][]float64 layout of the rest of
+// the package.
+func (s *Spectrogram32) Float64() [][]float64 {
+	frames := make([][]float64, s.Frames)
+	for t := range frames {
+		frame := make([]float64, s.Bins)
+		for k, v := range s.Frame(t) {
+			frame[k] = float64(v)
+		}
+		frames[t] = frame
+	}
+	return frames
+}
+
+// MagnitudeSpectrogram32 returns the magnitude spectrum of every windowed
+// frame of signal, computed like MagnitudeFrames. The FFT runs in float64
+// and only the magnitudes are rounded to float32, so they are within
+// float32 precision of ComputeFFT on the same samples. Data comes from
+// pool, which may be nil.
+func MagnitudeSpectrogram32(signal []float32, spec STFTSpec, pool *Float32Pool) (*Spectrogram32, error) {
+	window, err := spec.window()
+	if err != nil {
+		return nil, err
+	}
+	numFrames := frameCount(len(signal), spec.FrameSize, spec.HopSize, spec.Padding)
+	bins := spec.FrameSize/2 + 1
+	s := &Spectrogram32{Data: pool.Get(numFrames * bins), Frames: numFrames, Bins: bins}
+	eachMagnitudeFrame(signal, spec, window, func(t int, magnitudes []float64) {
+		row := s.Frame(t)
+		for k, m := range magnitudes {
+			row[k] = float32(m)
+		}
+	})
+	return s, nil
+}
+
+// FrameRMS32 is FrameRMS on a float32 signal. Frames are read in place
+// rather than copied.
+func FrameRMS32(signal []float32, frameSize, hopSize int, padding Padding) ([]float64, error) {
+	if err := checkFraming(frameSize, hopSize); err != nil {
+		return nil, err
+	}
+	rms := make([]float64, frameCount(len(signal), frameSize, hopSize, padding))
+	block := make([]float64, frameSize)
+	for t := range rms {
+		frameInto(block, signal, t, hopSize, padding)
+		e := 0.0
+		for _, x := range block {
+			e += x * x
+		}
+		rms[t] = math.Sqrt(e / float64(frameSize))
+	}
+	return rms, nil
+}
@@ -0,0 +1,206 @@
+package dsp
+
+// MaxResamplerPhases bounds the number of polyphase branches. Ratios that
+// would need more, such as 44101 Hz to 11025 Hz, round the sub-sample
+// position to the nearest of this many phases.
+const MaxResamplerPhases = 1024
+
+// Resampler converts a signal from one sample rate to another by a
+// rational factor with a polyphase low-pass FIR filter. Only the output
+// samples are computed, so decimating by 4 costs a quarter of filtering at
+// the input rate.
+type Resampler struct {
+	up, down int         // Output rate / input rate = up / down, in lowest terms.
+	phases   [][]float64 // One set of numTaps coefficients per sub-sample position.
+	phases32 [][]float32 // phases rounded to float32, for Resample32.
+}
+
+// NewResampler returns a resampler from inRate to outRate. numTaps is the
+// filter length per output sample at the input rate and must be odd; the
+// cutoff is half the lower of the two rates.
+//
+// With an integer decimation factor the result is that of ApplyFIRFilter
+// with GenerateLowPassKernel followed by keeping every factor-th sample,
+// to rounding: ApplyFIRFilter convolves through the FFT, while the
+// resampler sums the taps directly.
+func NewResampler(inRate, outRate, numTaps int) *Resampler {
+	g := gcd(inRate, outRate)
+	up, down := outRate/g, inRate/g
+	numPhases := min(up, MaxResamplerPhases)
+
+	// The prototype filter runs at numPhases times the input rate and is
+	// long enough for every phase to have numTaps coefficients.
+	half := numTaps / 2
+	center := half*numPhases + numPhases - 1
+	cutoff := float64(min(inRate, outRate)) / 2
+	prototype := GenerateLowPassKernel(cutoff, inRate*numPhases, 2*center+1)
+
+	phases := make([][]float64, numPhases)
+	phases32 := make([][]float32, numPhases)
+	for p := range phases {
+		coeffs := make([]float64, numTaps)
+		sum := 0.0
+		for j := range coeffs {
+			coeffs[j] = prototype[center-p-half*numPhases+j*numPhases]
+			sum += coeffs[j]
+		}
+		if numPhases > 1 {
+			for j := range coeffs {
+				coeffs[j] /= sum
+			}
+		}
+		phases[p] = coeffs
+		phases32[p] = make([]float32, numTaps)
+		for j, c := range coeffs {
+			phases32[p][j] = float32(c)
+		}
+	}
+	return &Resampler{up: up, down: down, phases: phases, phases32: phases32}
+}
+
+// Resample filters and resamples input. Output sample m is taken at input
+// position m*inRate/outRate, so the output has ceil(len(input)*outRate/inRate)
+// samples. Samples outside the input are treated as zero.
+func (r *Resampler) Resample(input []float64) []float64 {
+	n := len(input)
+	if n == 0 {
+		return []float64{}
+	}
+	numPhases := len(r.phases)
+	numTaps := len(r.phases[0])
+	half := numTaps / 2
+	output := make([]float64, (n*r.up+r.down-1)/r.down)
+	for m := range output {
+		t := m * r.down
+		base, p := t/r.up, t%r.up
+		if numPhases != r.up {
+			p = (p*numPhases + r.up/2) / r.up
+			if p == numPhases {
+				base, p = base+1, 0
+			}
+		}
+		coeffs := r.phases[p]
+		acc := 0.0
+		for j := 0; j < numTaps; j++ {
+			idx := base + j - half
+			if idx < 0 {
+				continue
+			}
+			if idx >= n {
+				break
+			}
+			acc += input[idx] * coeffs[j]
+		}
+		output[m] = acc
+	}
+	return output
+}
+
+// Resample32 is Resample in float32, with the coefficients rounded to
+// float32 and the products summed in float32. The output differs from
+// Resample by float32 rounding, under 5e-7 of full scale.
+func (r *Resampler) Resample32(input []float32) []float32 {
+	return resample32(r, input, 1)
+}
+
+// resample32 resamples int16 or float32 input, multiplying every output
+// sample by scale.
+func resample32[T int16 | float32](r *Resampler, input []T, scale float32) []float32 {
+	n := len(input)
+	if n == 0 {
+		return []float32{}
+	}
+	numPhases := len(r.phases32)
+	numTaps := len(r.phases32[0])
+	half := numTaps / 2
+	output := make([]float32, (n*r.up+r.down-1)/r.down)
+	for m := range output {
+		t := m * r.down
+		base, p := t/r.up, t%r.up
+		if numPhases != r.up {
+			p = (p*numPhases + r.up/2) / r.up
+			if p == numPhases {
+				base, p = base+1, 0
+			}
+		}
+		// Only the taps over the input, as one contiguous run.
+		lo, hi := max(half-base, 0), min(numTaps, n-base+half)
+		if lo >= hi {
+			continue
+		}
+		coeffs := r.phases32[p][lo:hi]
+		var acc float32
+		for j, x := range input[base-half+lo : base-half+hi] {
+			acc += float32(x) * coeffs[j]
+		}
+		output[m] = acc * scale
+	}
+	return output
+}
+
+// MultiStageResampler reduces high sample rates in steps: cheap
+// decimate-by-2 stages bring the rate down before a final Resampler, so
+// that the final filter's transition band is narrow without a long filter
+// at the input rate.
+type MultiStageResampler struct {
+	stages []*Resampler
+}
+
+// NewMultiStageResampler returns a resampler from inRate to outRate. While
+// the rate is even and at least 8 times outRate it is halved by a short
+// filter that only has to keep aliases out of the band below outRate/2.
+// The final stage is NewResampler(rate, outRate, numTaps), so ratios below
+// 8 use a single stage.
+func NewMultiStageResampler(inRate, outRate, numTaps int) *MultiStageResampler {
+	var stages []*Resampler
+	rate := inRate
+	for rate%2 == 0 && rate >= 8*outRate {
+		// Pass up to outRate/2 and stop from rate/2 - outRate/2 on; a
+		// Hamming-windowed sinc needs about 3.3 taps per transition width.
+		transition := rate/2 - outRate
+		taps := 2*((2*rate+transition-1)/transition) + 1
+		stages = append(stages, NewResampler(rate, rate/2, max(taps, 7)))
+		rate /= 2
+	}
+	stages = append(stages, NewResampler(rate, outRate, numTaps))
+	return &MultiStageResampler{stages: stages}
+}
+
+// Resample runs input through every stage.
+func (r *MultiStageResampler) Resample(input []float64) []float64 {
+	for _, s := range r.stages {
+		input = s.Resample(input)
+	}
+	return input
+}
+
+// Resample32 runs float32 input through every stage with Resample32.
+func (r *MultiStageResampler) Resample32(input []float32) []float32 {
+	for _, s := range r.stages {
+		input = s.Resample32(input)
+	}
+	return input
+}
+
+// ResampleInt16 resamples 16-bit samples, scaled to [-1, 1), like
+// Resample32. The first stage reads the samples directly, so no float
+// copy of the input is made at its full rate.
+func (r *MultiStageResampler) ResampleInt16(samples []int16) []float32 {
+	output := resample32(r.stages[0], samples, 1.0/32768)
+	for _, s := range r.stages[1:] {
+		output = s.Resample32(output)
+	}
+	return output
+}
+
+// Stages returns the number of stages.
+func (r *MultiStageResampler) Stages() int {
+	return len(r.stages)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
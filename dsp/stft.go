@@ -0,0 +1,252 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Padding selects how a signal is split into frames at its edges.
+type Padding int
+
+const (
+	// PadNone starts the first frame at the first sample and keeps only
+	// complete frames, dropping a trailing partial frame.
+	PadNone Padding = iota
+	// PadCentre centres frame t on sample t*hop, padding with zeros so
+	// that the first and last samples get whole frames.
+	PadCentre
+	// PadReflect centres frames like PadCentre but pads by mirroring the
+	// signal about its first and last samples, which avoids the click of
+	// a jump to zero.
+	PadReflect
+)
+
+// STFTSpec describes a short-time Fourier transform.
+type STFTSpec struct {
+	FrameSize int     // Samples per frame.
+	HopSize   int     // Samples between frame starts, at most FrameSize.
+	Window    Window  // Analysis and synthesis window.
+	Padding   Padding // Framing at the edges of the signal.
+}
+
+// Frame splits signal into frames of frameSize samples, hopSize apart,
+// with the edges handled by padding. Every frame is a new slice. Both
+// sizes must be at least 1.
+func Frame(signal []float64, frameSize, hopSize int, padding Padding) ([][]float64, error) {
+	if err := checkFraming(frameSize, hopSize); err != nil {
+		return nil, err
+	}
+	n := len(signal)
+	var frames [][]float64
+	if padding == PadNone {
+		for start := 0; start+frameSize <= n; start += hopSize {
+			frame := make([]float64, frameSize)
+			copy(frame, signal[start:start+frameSize])
+			frames = append(frames, frame)
+		}
+		return frames, nil
+	}
+
+	boundary := BoundaryZero
+	if padding == PadReflect {
+		boundary = BoundaryReflect
+	}
+	for centre := 0; centre < n; centre += hopSize {
+		frame := make([]float64, frameSize)
+		start := centre - frameSize/2
+		for i := range frame {
+			if j, ok := boundaryIndex(start+i, n, boundary); ok {
+				frame[i] = signal[j]
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// checkFraming validates the frame and hop sizes of Frame and the
+// functions built on it.
+func checkFraming(frameSize, hopSize int) error {
+	if frameSize < 1 {
+		return fmt.Errorf("frame size %d must be at least 1", frameSize)
+	}
+	if hopSize < 1 {
+		return fmt.Errorf("hop size %d must be at least 1", hopSize)
+	}
+	return nil
+}
+
+// STFT returns the complex spectrum of every windowed frame of signal.
+// Each frame holds FrameSize/2+1 bins, from DC to Nyquist.
+func STFT(signal []float64, spec STFTSpec) ([][]complex128, error) {
+	window, err := spec.window()
+	if err != nil {
+		return nil, err
+	}
+	frames, err := Frame(signal, spec.FrameSize, spec.HopSize, spec.Padding)
+	if err != nil {
+		return nil, err
+	}
+	fft := fourier.NewFFT(spec.FrameSize)
+	spectra := make([][]complex128, len(frames))
+	for t, frame := range frames {
+		for i := range frame {
+			frame[i] *= window[i]
+		}
+		spectra[t] = fft.Coefficients(nil, frame)
+	}
+	return spectra, nil
+}
+
+// MagnitudeFrames computes the magnitude spectrum of every windowed frame
+// of signal, framed like Frame, and calls fn with the index of the frame
+// and its FrameSize/2+1 magnitudes. The frames are streamed to one worker
+// per CPU, each with its own FFT and buffers, so neither the frames nor
+// the spectrogram are held in memory. fn is called concurrently and must
+// not keep magnitudes, which the worker reuses.
+func MagnitudeFrames(signal []float64, spec STFTSpec, fn func(t int, magnitudes []float64)) error {
+	window, err := spec.window()
+	if err != nil {
+		return err
+	}
+	eachMagnitudeFrame(signal, spec, window, fn)
+	return nil
+}
+
+// eachMagnitudeFrame is MagnitudeFrames on a signal of either precision
+// with a validated spec and its window.
+func eachMagnitudeFrame[T float32 | float64](signal []T, spec STFTSpec, window []float64, fn func(t int, magnitudes []float64)) {
+	numFrames := frameCount(len(signal), spec.FrameSize, spec.HopSize, spec.Padding)
+	workers := max(min(runtime.GOMAXPROCS(0), numFrames), 1)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func(first, last int) {
+			defer wg.Done()
+			fft := fourier.NewFFT(spec.FrameSize)
+			block := make([]float64, spec.FrameSize)
+			coeffs := make([]complex128, spec.FrameSize/2+1)
+			magnitudes := make([]float64, len(coeffs))
+			for t := first; t < last; t++ {
+				frameInto(block, signal, t, spec.HopSize, spec.Padding)
+				for i, w := range window {
+					block[i] *= w
+				}
+				fft.Coefficients(coeffs, block)
+				for k, c := range coeffs {
+					magnitudes[k] = math.Hypot(real(c), imag(c))
+				}
+				fn(t, magnitudes)
+			}
+		}(w*numFrames/workers, (w+1)*numFrames/workers)
+	}
+	wg.Wait()
+}
+
+// frameCount returns the number of frames Frame splits n samples into.
+// The sizes must have passed checkFraming.
+func frameCount(n, frameSize, hopSize int, padding Padding) int {
+	if padding == PadNone {
+		if n < frameSize {
+			return 0
+		}
+		return (n-frameSize)/hopSize + 1
+	}
+	return (n + hopSize - 1) / hopSize
+}
+
+// frameInto copies frame t of signal, as Frame would return it, into dst.
+func frameInto[T float32 | float64](dst []float64, signal []T, t, hopSize int, padding Padding) {
+	n := len(signal)
+	start := t * hopSize
+	if padding != PadNone {
+		start -= len(dst) / 2
+	}
+	if start >= 0 && start+len(dst) <= n {
+		for i, x := range signal[start : start+len(dst)] {
+			dst[i] = float64(x)
+		}
+		return
+	}
+
+	boundary := BoundaryZero
+	if padding == PadReflect {
+		boundary = BoundaryReflect
+	}
+	for i := range dst {
+		dst[i] = 0
+		if j, ok := boundaryIndex(start+i, n, boundary); ok {
+			dst[i] = float64(signal[j])
+		}
+	}
+}
+
+// ISTFT resynthesises a signal from frames produced by STFT with the same
+// spec. Frames are windowed again and overlap-added, and every sample is
+// divided by the sum of the squared windows over it, so an unmodified STFT
+// is inverted exactly wherever that sum is non-zero. Samples no window
+// covers are zero.
+//
+// length is the length of the original signal. If it is zero, the output
+// runs to the end of the last frame.
+func ISTFT(frames [][]complex128, spec STFTSpec, length int) ([]float64, error) {
+	window, err := spec.window()
+	if err != nil {
+		return nil, err
+	}
+	bins := spec.FrameSize/2 + 1
+	for t, frame := range frames {
+		if len(frame) != bins {
+			return nil, fmt.Errorf("frame %d has %d bins, expected %d", t, len(frame), bins)
+		}
+	}
+
+	offset := 0
+	if spec.Padding != PadNone {
+		offset = spec.FrameSize / 2
+	}
+	total := 0
+	if len(frames) > 0 {
+		total = (len(frames)-1)*spec.HopSize + spec.FrameSize
+	}
+	sum := make([]float64, total)
+	norm := make([]float64, total)
+	fft := fourier.NewFFT(spec.FrameSize)
+	block := make([]float64, spec.FrameSize)
+	scale := 1 / float64(spec.FrameSize)
+	for t, frame := range frames {
+		fft.Sequence(block, frame)
+		start := t * spec.HopSize
+		for i, w := range window {
+			sum[start+i] += block[i] * scale * w
+			norm[start+i] += w * w
+		}
+	}
+
+	if length <= 0 {
+		length = max(total-offset, 0)
+	}
+	out := make([]float64, length)
+	for i := range out {
+		j := i + offset
+		if j < total && norm[j] > 1e-10 {
+			out[i] = sum[j] / norm[j]
+		}
+	}
+	return out, nil
+}
+
+// window validates the spec and returns its window.
+func (spec STFTSpec) window() ([]float64, error) {
+	if spec.HopSize < 1 || spec.HopSize > spec.FrameSize {
+		return nil, fmt.Errorf("hop size %d must be between 1 and the frame size %d", spec.HopSize, spec.FrameSize)
+	}
+	if spec.Padding < PadNone || spec.Padding > PadReflect {
+		return nil, fmt.Errorf("unknown padding %d", spec.Padding)
+	}
+	return spec.Window.Coefficients(spec.FrameSize)
+}
@@ -0,0 +1,152 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// WindowType selects a window function for spectral analysis or FIR design.
+type WindowType int
+
+const (
+	WindowHamming WindowType = iota
+	WindowHann
+	WindowBlackman
+	WindowBlackmanHarris
+	WindowKaiser
+	WindowFlatTop
+)
+
+// Window describes a window function. The zero value is a Hamming window.
+// Beta is the shape of a Kaiser window: 0 is rectangular, 5 is close to
+// Hamming, and larger values trade main-lobe width for lower side lobes.
+// It is ignored by the other types.
+type Window struct {
+	Type WindowType
+	Beta float64
+}
+
+type windowKey struct {
+	window Window
+	size   int
+}
+
+var windowCache sync.Map // windowKey -> []float64
+
+// Coefficients returns the window of n points. Windows are cached by type
+// and size, so the returned slice is shared and must not be modified.
+func (w Window) Coefficients(n int) ([]float64, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("window size %d must be positive", n)
+	}
+	if w.Type != WindowKaiser {
+		w.Beta = 0
+	} else if w.Beta < 0 {
+		return nil, fmt.Errorf("kaiser beta %g must not be negative", w.Beta)
+	}
+	key := windowKey{w, n}
+	if cached, ok := windowCache.Load(key); ok {
+		return cached.([]float64), nil
+	}
+
+	var window []float64
+	switch w.Type {
+	case WindowHamming:
+		window = HammingWindow(n)
+	case WindowHann:
+		window = HannWindow(n)
+	case WindowBlackman:
+		window = BlackmanWindow(n)
+	case WindowBlackmanHarris:
+		window = BlackmanHarrisWindow(n)
+	case WindowKaiser:
+		window = KaiserWindow(n, w.Beta)
+	case WindowFlatTop:
+		window = FlatTopWindow(n)
+	default:
+		return nil, fmt.Errorf("unknown window type %d", w.Type)
+	}
+	cached, _ := windowCache.LoadOrStore(key, window)
+	return cached.([]float64), nil
+}
+
+// HammingWindow returns a Hamming window of n points, with about 43 dB of
+// side-lobe suppression.
+func HammingWindow(n int) []float64 {
+	return cosineWindow(n, 0.54, 0.46)
+}
+
+// HannWindow returns a Hann window of n points. Its side lobes fall off
+// faster than Hamming's, at the cost of a higher first side lobe.
+func HannWindow(n int) []float64 {
+	return cosineWindow(n, 0.5, 0.5)
+}
+
+// BlackmanWindow returns a Blackman window of n points, with about 58 dB
+// of side-lobe suppression.
+func BlackmanWindow(n int) []float64 {
+	return cosineWindow(n, 0.42, 0.5, 0.08)
+}
+
+// BlackmanHarrisWindow returns a four-term Blackman-Harris window of n
+// points, with about 92 dB of side-lobe suppression.
+func BlackmanHarrisWindow(n int) []float64 {
+	return cosineWindow(n, 0.35875, 0.48829, 0.14128, 0.01168)
+}
+
+// FlatTopWindow returns a flat-top window of n points. Its wide, flat main
+// lobe measures the amplitude of a tone to within 0.01 dB wherever it
+// falls between bins.
+func FlatTopWindow(n int) []float64 {
+	return cosineWindow(n, 0.21557895, 0.41663158, 0.277263158, 0.083578947, 0.006947368)
+}
+
+// KaiserWindow returns a Kaiser window of n points with shape β.
+func KaiserWindow(n int, beta float64) []float64 {
+	if n == 1 {
+		return []float64{1}
+	}
+	window := make([]float64, n)
+	denom := besselI0(beta)
+	for i := range window {
+		r := 2*float64(i)/float64(n-1) - 1
+		window[i] = besselI0(beta*math.Sqrt(1-r*r)) / denom
+	}
+	return window
+}
+
+// cosineWindow returns the symmetric window
+// a0 - a1*cos(2πi/(n-1)) + a2*cos(4πi/(n-1)) - ...
+func cosineWindow(n int, coeffs ...float64) []float64 {
+	if n == 1 {
+		return []float64{1}
+	}
+	window := make([]float64, n)
+	m := float64(n - 1)
+	for i := range window {
+		w := coeffs[0]
+		for k := 1; k < len(coeffs); k++ {
+			term := coeffs[k] * math.Cos(2*math.Pi*float64(k*i)/m)
+			if k%2 == 1 {
+				w -= term
+			} else {
+				w += term
+			}
+		}
+		window[i] = w
+	}
+	return window
+}
+
+// besselI0 evaluates the zeroth-order modified Bessel function of the
+// first kind by its power series.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		f := x / (2 * float64(k))
+		term *= f * f
+		sum += term
+	}
+	return sum
+}
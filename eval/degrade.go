@@ -0,0 +1,219 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"fingerprint/dsp"
+)
+
+// DegradeTaps is the FIR length used by the filtering degradations. It is
+// longer than fingerprint.FilterTaps so that low cutoffs stay sharp.
+const DegradeTaps = 255
+
+// Clip is a mono audio signal normalised to [-1, 1].
+type Clip struct {
+	Samples    []float64
+	SampleRate int
+}
+
+// Degradation transforms a query clip to simulate a real-world capture.
+type Degradation struct {
+	Name  string
+	Param float64 // SNR in dB for noise, otherwise the degradation's own unit.
+	Apply func(c Clip, rng *rand.Rand) Clip
+}
+
+func (d Degradation) String() string {
+	if d.Name == "clean" {
+		return d.Name
+	}
+	return fmt.Sprintf("%s(%g)", d.Name, d.Param)
+}
+
+// Clean leaves the query untouched and serves as the baseline.
+func Clean() Degradation {
+	return Degradation{Name: "clean", Apply: func(c Clip, _ *rand.Rand) Clip { return c }}
+}
+
+// WhiteNoise adds Gaussian white noise at the given signal-to-noise ratio.
+func WhiteNoise(snr float64) Degradation {
+	return Degradation{Name: "white-noise", Param: snr, Apply: func(c Clip, rng *rand.Rand) Clip {
+		noise := make([]float64, len(c.Samples))
+		for i := range noise {
+			noise[i] = rng.NormFloat64()
+		}
+		return addNoise(c, noise, snr)
+	}}
+}
+
+// PinkNoise adds 1/f noise at the given signal-to-noise ratio, shaped from
+// white noise with Paul Kellet's economy filter.
+func PinkNoise(snr float64) Degradation {
+	return Degradation{Name: "pink-noise", Param: snr, Apply: func(c Clip, rng *rand.Rand) Clip {
+		noise := make([]float64, len(c.Samples))
+		var b0, b1, b2 float64
+		for i := range noise {
+			w := rng.NormFloat64()
+			b0 = 0.99765*b0 + w*0.0990460
+			b1 = 0.96300*b1 + w*0.2965164
+			b2 = 0.57000*b2 + w*1.0526913
+			noise[i] = b0 + b1 + b2 + w*0.1848
+		}
+		return addNoise(c, noise, snr)
+	}}
+}
+
+// addNoise scales the noise to the requested SNR and mixes it into the clip.
+func addNoise(c Clip, noise []float64, snr float64) Clip {
+	signalPower := power(c.Samples)
+	noisePower := power(noise)
+	scale := 0.0
+	if noisePower > 0 {
+		scale = math.Sqrt(signalPower / math.Pow(10, snr/10) / noisePower)
+	}
+	out := make([]float64, len(c.Samples))
+	for i, s := range c.Samples {
+		out[i] = s + scale*noise[i]
+	}
+	return Clip{Samples: out, SampleRate: c.SampleRate}
+}
+
+// Gain changes the level by the given number of dB.
+func Gain(db float64) Degradation {
+	return Degradation{Name: "gain", Param: db, Apply: func(c Clip, _ *rand.Rand) Clip {
+		g := math.Pow(10, db/20)
+		out := make([]float64, len(c.Samples))
+		for i, s := range c.Samples {
+			out[i] = s * g
+		}
+		return Clip{Samples: out, SampleRate: c.SampleRate}
+	}}
+}
+
+// EQ boosts or cuts everything below 500 Hz by the given number of dB,
+// like a bass shelf on a cheap speaker or phone.
+func EQ(db float64) Degradation {
+	return Degradation{Name: "eq", Param: db, Apply: func(c Clip, _ *rand.Rand) Clip {
+		kernel := dsp.GenerateLowPassKernel(500, c.SampleRate, DegradeTaps)
+		low := dsp.ApplyFIRFilter(c.Samples, kernel)
+		g := math.Pow(10, db/20) - 1
+		out := make([]float64, len(c.Samples))
+		for i, s := range c.Samples {
+			out[i] = s + g*low[i]
+		}
+		return Clip{Samples: out, SampleRate: c.SampleRate}
+	}}
+}
+
+// LowPass removes everything above the cutoff frequency in Hz.
+func LowPass(cutoff float64) Degradation {
+	return Degradation{Name: "low-pass", Param: cutoff, Apply: func(c Clip, _ *rand.Rand) Clip {
+		kernel := dsp.GenerateLowPassKernel(cutoff, c.SampleRate, DegradeTaps)
+		return Clip{Samples: dsp.ApplyFIRFilter(c.Samples, kernel), SampleRate: c.SampleRate}
+	}}
+}
+
+// Clipping hard-limits the signal at the given fraction of its peak level.
+func Clipping(level float64) Degradation {
+	return Degradation{Name: "clipping", Param: level, Apply: func(c Clip, _ *rand.Rand) Clip {
+		peak := 0.0
+		for _, s := range c.Samples {
+			peak = math.Max(peak, math.Abs(s))
+		}
+		limit := peak * level
+		out := make([]float64, len(c.Samples))
+		for i, s := range c.Samples {
+			out[i] = math.Max(-limit, math.Min(limit, s))
+		}
+		return Clip{Samples: out, SampleRate: c.SampleRate}
+	}}
+}
+
+// Offset drops the given number of milliseconds from the start of the query,
+// so that its frames no longer line up with the reference frames.
+func Offset(ms float64) Degradation {
+	return Degradation{Name: "offset", Param: ms, Apply: func(c Clip, _ *rand.Rand) Clip {
+		n := min(int(ms*float64(c.SampleRate)/1000), len(c.Samples))
+		return Clip{Samples: c.Samples[n:], SampleRate: c.SampleRate}
+	}}
+}
+
+// Excerpt keeps only the first given number of seconds of the query.
+func Excerpt(seconds float64) Degradation {
+	return Degradation{Name: "excerpt", Param: seconds, Apply: func(c Clip, _ *rand.Rand) Clip {
+		n := min(int(seconds*float64(c.SampleRate)), len(c.Samples))
+		return Clip{Samples: c.Samples[:n], SampleRate: c.SampleRate}
+	}}
+}
+
+// Resample converts the query to a different sample rate in Hz.
+func Resample(rate int) Degradation {
+	return Degradation{Name: "resample", Param: float64(rate), Apply: func(c Clip, _ *rand.Rand) Clip {
+		return Clip{Samples: stretch(c.Samples, c.SampleRate, float64(c.SampleRate)/float64(rate)), SampleRate: rate}
+	}}
+}
+
+// Tempo plays the query back faster (factor > 1) or slower (factor < 1),
+// changing pitch along with tempo like a turntable or tape speed change.
+func Tempo(factor float64) Degradation {
+	return Degradation{Name: "tempo", Param: factor, Apply: func(c Clip, _ *rand.Rand) Clip {
+		return Clip{Samples: stretch(c.Samples, c.SampleRate, factor), SampleRate: c.SampleRate}
+	}}
+}
+
+// stretch reads the signal with the given step using linear interpolation.
+// When step > 1 the signal is low-pass filtered first to avoid aliasing.
+func stretch(samples []float64, sampleRate int, step float64) []float64 {
+	if step > 1 {
+		kernel := dsp.GenerateLowPassKernel(float64(sampleRate)/2/step, sampleRate, DegradeTaps)
+		samples = dsp.ApplyFIRFilter(samples, kernel)
+	}
+	n := int(float64(len(samples)-1)/step) + 1
+	if len(samples) == 0 {
+		n = 0
+	}
+	out := make([]float64, n)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		frac := pos - float64(j)
+		if j+1 < len(samples) {
+			out[i] = samples[j]*(1-frac) + samples[j+1]*frac
+		} else {
+			out[i] = samples[j]
+		}
+	}
+	return out
+}
+
+func power(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += s * s
+	}
+	return sum / float64(len(samples))
+}
+
+// Suite returns the clean baseline, white and pink noise at every SNR, and
+// one moderate setting of each of the other degradations.
+func Suite(snrs []float64) []Degradation {
+	suite := []Degradation{Clean()}
+	for _, snr := range snrs {
+		suite = append(suite, WhiteNoise(snr), PinkNoise(snr))
+	}
+	return append(suite,
+		Gain(-12),
+		EQ(9),
+		LowPass(2000),
+		Clipping(0.3),
+		Offset(20),
+		Resample(22050),
+		Excerpt(3),
+		Tempo(1.05),
+	)
+}
@@ -0,0 +1,265 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"text/tabwriter"
+
+	"fingerprint/fingerprint"
+	"fingerprint/index"
+)
+
+// Reference is a recording that the system under test indexes.
+type Reference struct {
+	Name       string
+	Samples    []int16
+	SampleRate int
+}
+
+// System is a fingerprinting method under evaluation.
+type System interface {
+	Name() string
+	// Add indexes a reference under the given ID.
+	Add(id int, samples []int16, sampleRate int) error
+	// Query returns the ID of the matching reference, if any.
+	Query(samples []int16, sampleRate int) (id int, ok bool, err error)
+}
+
+// Config controls how queries are cut from the references.
+type Config struct {
+	QueryLength         float64 // Query length in seconds before degradation.
+	QueriesPerReference int     // Queries taken from random positions of each reference.
+	Seed                int64   // Seed for query positions and noise.
+}
+
+// DefaultConfig returns ten-second queries, three per reference.
+func DefaultConfig() Config {
+	return Config{QueryLength: 10, QueriesPerReference: 3, Seed: 1}
+}
+
+// Result counts the outcomes for one degradation.
+type Result struct {
+	Degradation   Degradation
+	Queries       int // Queries cut from indexed references.
+	Answered      int // Queries from indexed references that returned a match.
+	Correct       int // Answered queries that returned the right reference.
+	Negatives     int // Queries cut from references that are not indexed.
+	TrueNegatives int // Negative queries that returned no match.
+}
+
+// Precision is the fraction of returned matches that were correct,
+// counting matches returned for negative queries as wrong.
+func (r Result) Precision() float64 {
+	answered := r.Answered + r.Negatives - r.TrueNegatives
+	if answered == 0 {
+		return 1
+	}
+	return float64(r.Correct) / float64(answered)
+}
+
+// Recall is the fraction of queries from indexed references that were
+// matched to the right reference.
+func (r Result) Recall() float64 {
+	if r.Queries == 0 {
+		return 0
+	}
+	return float64(r.Correct) / float64(r.Queries)
+}
+
+// Accuracy is the fraction of all queries, positive and negative, that got
+// the right answer. Without negative queries it equals Recall.
+func (r Result) Accuracy() float64 {
+	total := r.Queries + r.Negatives
+	if total == 0 {
+		return 0
+	}
+	return float64(r.Correct+r.TrueNegatives) / float64(total)
+}
+
+// Report holds the results of one system for every degradation.
+type Report struct {
+	System  string
+	Results []Result
+}
+
+// WriteTable prints the report as an aligned text table.
+func (r Report) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "system: %s\n", r.System)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "degradation\tparam\tqueries\tprecision\trecall\taccuracy")
+	for _, res := range r.Results {
+		param := "-"
+		if res.Degradation.Name != "clean" {
+			param = fmt.Sprintf("%g", res.Degradation.Param)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.3f\t%.3f\t%.3f\n", res.Degradation.Name, param,
+			res.Queries+res.Negatives, res.Precision(), res.Recall(), res.Accuracy())
+	}
+	return tw.Flush()
+}
+
+// Run indexes the references, cuts queries from them and from the negatives,
+// applies every degradation and records how the system answers. The same
+// query positions are used for every degradation so results are comparable.
+func Run(system System, refs, negatives []Reference, degradations []Degradation, cfg Config) (Report, error) {
+	for id, ref := range refs {
+		if err := system.Add(id, ref.Samples, ref.SampleRate); err != nil {
+			return Report{}, fmt.Errorf("indexing %s: %w", ref.Name, err)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	positives := cutQueries(refs, cfg, rng)
+	negativeQueries := cutQueries(negatives, cfg, rng)
+
+	report := Report{System: system.Name()}
+	for di, d := range degradations {
+		res := Result{Degradation: d}
+		for qi, q := range positives {
+			id, ok, err := runQuery(system, d, q.clip, cfg.Seed+int64(di*1000003+qi))
+			if err != nil {
+				return Report{}, fmt.Errorf("%s on %s: %w", d, refs[q.ref].Name, err)
+			}
+			res.Queries++
+			if ok {
+				res.Answered++
+				if id == q.ref {
+					res.Correct++
+				}
+			}
+		}
+		for qi, q := range negativeQueries {
+			_, ok, err := runQuery(system, d, q.clip, cfg.Seed-int64(di*1000003+qi)-1)
+			if err != nil {
+				return Report{}, fmt.Errorf("%s on %s: %w", d, negatives[q.ref].Name, err)
+			}
+			res.Negatives++
+			if !ok {
+				res.TrueNegatives++
+			}
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+type query struct {
+	ref  int
+	clip Clip
+}
+
+// cutQueries takes QueriesPerReference clips of QueryLength seconds from
+// random positions of every reference.
+func cutQueries(refs []Reference, cfg Config, rng *rand.Rand) []query {
+	var queries []query
+	for i, ref := range refs {
+		samples := toFloat(ref.Samples)
+		n := min(int(cfg.QueryLength*float64(ref.SampleRate)), len(samples))
+		for q := 0; q < cfg.QueriesPerReference; q++ {
+			start := rng.Intn(len(samples) - n + 1)
+			queries = append(queries, query{
+				ref:  i,
+				clip: Clip{Samples: samples[start : start+n], SampleRate: ref.SampleRate},
+			})
+		}
+	}
+	return queries
+}
+
+func runQuery(system System, d Degradation, clip Clip, seed int64) (int, bool, error) {
+	degraded := d.Apply(clip, rand.New(rand.NewSource(seed)))
+	return system.Query(toInt16(degraded.Samples), degraded.SampleRate)
+}
+
+func toFloat(samples []int16) []float64 {
+	out := make([]float64, len(samples))
+	for i, s := range samples {
+		out[i] = float64(s) / 32768.0
+	}
+	return out
+}
+
+// toInt16 converts back to 16-bit PCM, saturating out-of-range values.
+func toInt16(samples []float64) []int16 {
+	out := make([]int16, len(samples))
+	for i, s := range samples {
+		out[i] = int16(math.Max(-32768, math.Min(32767, math.Round(s*32768))))
+	}
+	return out
+}
+
+// LandmarkSystem evaluates the pair hashes of fingerprint.Fingerprint with
+// offset-consistent lookup in an index.Index.
+type LandmarkSystem struct {
+	index *index.Index
+	ids   []int
+}
+
+// NewLandmarkSystem returns a landmark system with an empty index.
+func NewLandmarkSystem() *LandmarkSystem {
+	return &LandmarkSystem{index: index.New()}
+}
+
+func (s *LandmarkSystem) Name() string { return "landmark" }
+
+func (s *LandmarkSystem) Add(id int, samples []int16, sampleRate int) error {
+	peaks, err := fingerprint.ExtractPeaks(samples, sampleRate)
+	if err != nil {
+		return err
+	}
+	// Track IDs are assigned in insertion order, so ids maps them back.
+	s.index.Add(index.Track{Name: fmt.Sprint(id)}, fingerprint.Landmarks(peaks, fingerprint.TargetZoneFrames))
+	s.ids = append(s.ids, id)
+	return nil
+}
+
+func (s *LandmarkSystem) Query(samples []int16, sampleRate int) (int, bool, error) {
+	peaks, err := fingerprint.ExtractPeaks(samples, sampleRate)
+	if err != nil {
+		return -1, false, err
+	}
+	match, ok := s.index.Match(fingerprint.Landmarks(peaks, fingerprint.TargetZoneFrames))
+	if !ok {
+		return -1, false, nil
+	}
+	return s.ids[match.Track.ID], true, nil
+}
+
+// SubFingerprintSystem evaluates Haitsma–Kalker sub-fingerprints with an
+// exhaustive bit error rate search over all references.
+type SubFingerprintSystem struct {
+	refs map[int][]uint32
+}
+
+// NewSubFingerprintSystem returns a sub-fingerprint system with no references.
+func NewSubFingerprintSystem() *SubFingerprintSystem {
+	return &SubFingerprintSystem{refs: make(map[int][]uint32)}
+}
+
+func (s *SubFingerprintSystem) Name() string { return "subfingerprint" }
+
+func (s *SubFingerprintSystem) Add(id int, samples []int16, sampleRate int) error {
+	subs, err := fingerprint.SubFingerprint(samples, sampleRate)
+	if err != nil {
+		return err
+	}
+	s.refs[id] = subs
+	return nil
+}
+
+func (s *SubFingerprintSystem) Query(samples []int16, sampleRate int) (int, bool, error) {
+	query, err := fingerprint.SubFingerprint(samples, sampleRate)
+	if err != nil {
+		return -1, false, err
+	}
+	bestID, bestBER, found := -1, 1.0, false
+	for id, ref := range s.refs {
+		_, ber, ok := fingerprint.MatchSubFingerprints(query, ref)
+		if ok && (ber < bestBER || (ber == bestBER && id < bestID)) {
+			bestID, bestBER, found = id, ber, true
+		}
+	}
+	return bestID, found, nil
+}
@@ -0,0 +1,124 @@
+package eval_test
+
+import (
+	"fingerprint/eval"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// synthReference renders a random sequence of tones over a little noise.
+func synthReference(seed int64, seconds float64, sampleRate int) eval.Reference {
+	rng := rand.New(rand.NewSource(seed))
+	n := int(seconds * float64(sampleRate))
+	samples := make([]int16, n)
+	noteLen := sampleRate / 4
+	freqs := [3]float64{}
+	for i := range samples {
+		if i%noteLen == 0 {
+			for k := range freqs {
+				freqs[k] = 200 + rng.Float64()*3000
+			}
+		}
+		v := 0.0
+		for _, f := range freqs {
+			v += math.Sin(2 * math.Pi * f * float64(i) / float64(sampleRate))
+		}
+		samples[i] = int16(v*6000 + rng.NormFloat64()*300)
+	}
+	return eval.Reference{Name: "synth", Samples: samples, SampleRate: sampleRate}
+}
+
+func TestRun(t *testing.T) {
+	refs := []eval.Reference{
+		synthReference(1, 20, 22050),
+		synthReference(2, 20, 22050),
+	}
+	negatives := []eval.Reference{synthReference(3, 20, 22050)}
+	degradations := []eval.Degradation{eval.Clean(), eval.Gain(-6), eval.Offset(20)}
+	cfg := eval.Config{QueryLength: 5, QueriesPerReference: 2, Seed: 1}
+
+	for _, system := range []eval.System{eval.NewLandmarkSystem(), eval.NewSubFingerprintSystem()} {
+		report, err := eval.Run(system, refs, negatives, degradations, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", system.Name(), err)
+		}
+		if len(report.Results) != len(degradations) {
+			t.Fatalf("%s: expected %d results, got %d", system.Name(), len(degradations), len(report.Results))
+		}
+		for _, res := range report.Results {
+			if res.Queries != 4 || res.Negatives != 2 {
+				t.Errorf("%s %s: expected 4 positive and 2 negative queries, got %d and %d",
+					system.Name(), res.Degradation, res.Queries, res.Negatives)
+			}
+			if res.Accuracy() != 1 || res.Precision() != 1 || res.Recall() != 1 {
+				t.Errorf("%s %s: expected perfect scores, got precision %.2f recall %.2f accuracy %.2f",
+					system.Name(), res.Degradation, res.Precision(), res.Recall(), res.Accuracy())
+			}
+		}
+	}
+}
+
+func TestResultMetrics(t *testing.T) {
+	res := eval.Result{Queries: 10, Answered: 8, Correct: 6, Negatives: 10, TrueNegatives: 8}
+	if p := res.Precision(); math.Abs(p-0.6) > 1e-9 {
+		t.Errorf("expected precision 0.6, got %f", p)
+	}
+	if r := res.Recall(); math.Abs(r-0.6) > 1e-9 {
+		t.Errorf("expected recall 0.6, got %f", r)
+	}
+	if a := res.Accuracy(); math.Abs(a-0.7) > 1e-9 {
+		t.Errorf("expected accuracy 0.7, got %f", a)
+	}
+}
+
+func TestNoiseSNR(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/44100)
+	}
+	clip := eval.Clip{Samples: samples, SampleRate: 44100}
+
+	for _, d := range []eval.Degradation{eval.WhiteNoise(10), eval.PinkNoise(10)} {
+		noisy := d.Apply(clip, rng)
+		signal, noise := 0.0, 0.0
+		for i, s := range noisy.Samples {
+			signal += samples[i] * samples[i]
+			noise += (s - samples[i]) * (s - samples[i])
+		}
+		if snr := 10 * math.Log10(signal/noise); math.Abs(snr-10) > 1e-6 {
+			t.Errorf("%s: expected SNR 10 dB, got %f", d, snr)
+		}
+	}
+}
+
+func TestDegradationShapes(t *testing.T) {
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = math.Sin(2 * math.Pi * 100 * float64(i) / 44100)
+	}
+	clip := eval.Clip{Samples: samples, SampleRate: 44100}
+	rng := rand.New(rand.NewSource(1))
+
+	if c := eval.Resample(22050).Apply(clip, rng); c.SampleRate != 22050 || len(c.Samples) != 22050 {
+		t.Errorf("resample: expected 22050 samples at 22050 Hz, got %d at %d Hz", len(c.Samples), c.SampleRate)
+	}
+	if c := eval.Tempo(2).Apply(clip, rng); c.SampleRate != 44100 || len(c.Samples) != 22050 {
+		t.Errorf("tempo: expected 22050 samples at 44100 Hz, got %d at %d Hz", len(c.Samples), c.SampleRate)
+	}
+	if c := eval.Excerpt(0.5).Apply(clip, rng); len(c.Samples) != 22050 {
+		t.Errorf("excerpt: expected 22050 samples, got %d", len(c.Samples))
+	}
+	if c := eval.Offset(100).Apply(clip, rng); len(c.Samples) != 44100-4410 {
+		t.Errorf("offset: expected %d samples, got %d", 44100-4410, len(c.Samples))
+	}
+	for _, s := range eval.Clipping(0.5).Apply(clip, rng).Samples {
+		if math.Abs(s) > 0.5+1e-9 {
+			t.Fatalf("clipping: sample %f exceeds limit 0.5", s)
+		}
+	}
+	if c := eval.Gain(-20).Apply(clip, rng); math.Abs(c.Samples[110]-0.1*samples[110]) > 1e-9 {
+		t.Errorf("gain: expected %f, got %f", 0.1*samples[110], c.Samples[110])
+	}
+}
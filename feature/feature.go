@@ -0,0 +1,334 @@
+package feature
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"fingerprint/fingerprint"
+)
+
+const (
+	OnsetCompression = 100.0 // Gain before log compression of magnitudes in the spectral flux.
+	OnsetPeakWindow  = 3     // Frames either side an onset must be the maximum of.
+	OnsetMeanWindow  = 10    // Frames either side of the local mean an onset must exceed.
+	OnsetDelta       = 0.07  // Margin over the local mean, relative to the strongest onset.
+	OnsetMinGap      = 3     // Minimum frames between onsets (~140 ms).
+	MinTempo         = 60.0  // Slowest tempo considered, in BPM.
+	MaxTempo         = 200.0 // Fastest tempo considered, in BPM.
+	TempoPrior       = 120.0 // Centre of the log-normal tempo prior, in BPM.
+	TempoRefineBeats = 4     // Beats away at which the tempo period is refined.
+	BeatTightness    = 100.0 // Penalty for beat intervals deviating from the tempo.
+)
+
+// FrameRate is the number of spectrogram frames per second.
+const FrameRate = float64(fingerprint.TargetSampleRate) / fingerprint.HopSize
+
+// Features are auxiliary descriptions of a recording for segmentation and
+// tempo-invariant matching. Times are in seconds from the first sample.
+type Features struct {
+	Onsets []float64 // Note and percussion onsets.
+	Tempo  float64   // Estimated tempo in BPM, zero if none was found.
+	Beats  []float64 // Beat positions at Tempo.
+}
+
+// Extract computes the features of audio samples from the spectrogram
+// used for fingerprinting.
+func Extract(samples []int16, sampleRate int) (*Features, error) {
+	spectrogram, err := fingerprint.Spectrogram(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractFromSpectrogram(spectrogram), nil
+}
+
+// ExtractFromSpectrogram computes the features from a magnitude
+// spectrogram of the fingerprinting pipeline, such as the
+// Result.Spectrogram of an Analyze with KeepSpectrogram.
+func ExtractFromSpectrogram(spectrogram [][]float64) *Features {
+	strength := OnsetStrength(spectrogram)
+	f := &Features{
+		Onsets: frameTimes(Onsets(strength)),
+		Tempo:  Tempo(strength),
+	}
+	if f.Tempo > 0 {
+		f.Beats = frameTimes(Beats(strength, f.Tempo))
+	}
+	return f
+}
+
+// FrameTime returns the time in seconds of the centre of a spectrogram
+// frame.
+func FrameTime(frame int) float64 {
+	return float64(frame*fingerprint.HopSize+fingerprint.FrameSize/2) / fingerprint.TargetSampleRate
+}
+
+func frameTimes(frames []int) []float64 {
+	times := make([]float64, len(frames))
+	for i, t := range frames {
+		times[i] = FrameTime(t)
+	}
+	return times
+}
+
+// OnsetStrength returns the spectral flux of every frame of a magnitude
+// spectrogram: the sum over bins of the rise in log-compressed magnitude
+// since the previous frame. Decays are ignored, so the envelope peaks
+// where notes and hits start. The first frame is zero.
+func OnsetStrength(spectrogram [][]float64) []float64 {
+	strength := make([]float64, len(spectrogram))
+	for t := 1; t < len(spectrogram); t++ {
+		prev, frame := spectrogram[t-1], spectrogram[t]
+		for k := range frame {
+			rise := math.Log1p(OnsetCompression*frame[k]) - math.Log1p(OnsetCompression*prev[k])
+			strength[t] += max(rise, 0)
+		}
+	}
+	return strength
+}
+
+// Onsets picks the frames at which the onset strength peaks: the maximum
+// within OnsetPeakWindow frames, above the mean within OnsetMeanWindow
+// frames by OnsetDelta of the strongest frame, and at least OnsetMinGap
+// frames after the previous onset.
+func Onsets(strength []float64) []int {
+	peak := 0.0
+	for _, s := range strength {
+		peak = max(peak, s)
+	}
+	if peak == 0 {
+		return nil
+	}
+
+	var onsets []int
+	for t, s := range strength {
+		lo, hi := max(t-OnsetPeakWindow, 0), min(t+OnsetPeakWindow+1, len(strength))
+		isMax := true
+		for _, v := range strength[lo:hi] {
+			if v > s {
+				isMax = false
+				break
+			}
+		}
+		if !isMax {
+			continue
+		}
+		lo, hi = max(t-OnsetMeanWindow, 0), min(t+OnsetMeanWindow+1, len(strength))
+		mean := 0.0
+		for _, v := range strength[lo:hi] {
+			mean += v
+		}
+		mean /= float64(hi - lo)
+		if s < mean+OnsetDelta*peak {
+			continue
+		}
+		if len(onsets) > 0 && t-onsets[len(onsets)-1] < OnsetMinGap {
+			continue
+		}
+		onsets = append(onsets, t)
+	}
+	return onsets
+}
+
+// Tempo estimates the tempo in BPM from the autocorrelation of the onset
+// strength. Lags between MinTempo and MaxTempo are weighted by a
+// log-normal prior around TempoPrior, one octave wide, which settles
+// between a tempo and its half or double. The best lag is then refined by
+// parabolic interpolation of the autocorrelation peak TempoRefineBeats
+// beats away. It returns zero when the signal has no periodic onsets.
+func Tempo(strength []float64) float64 {
+	mean := 0.0
+	for _, s := range strength {
+		mean += s
+	}
+	mean /= float64(max(len(strength), 1))
+	centred := make([]float64, len(strength))
+	for i, s := range strength {
+		centred[i] = s - mean
+	}
+
+	minLag := int(math.Floor(60 * FrameRate / MaxTempo))
+	maxLag := int(math.Ceil(60 * FrameRate / MinTempo))
+	if maxLag+1 >= len(centred) {
+		return 0
+	}
+	// Lags up to a few beats, for refining the period at a multiple.
+	acf := make([]float64, min(TempoRefineBeats*maxLag+2, len(centred)))
+	for lag := range acf {
+		for i := lag; i < len(centred); i++ {
+			acf[lag] += centred[i] * centred[i-lag]
+		}
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := max(minLag, 1); lag <= maxLag; lag++ {
+		bpm := 60 * FrameRate / float64(lag)
+		weight := math.Exp(-0.5 * math.Pow(math.Log2(bpm/TempoPrior), 2))
+		if score := weight * acf[lag]; score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// A peak m beats away gives the period to 1/m of the frame resolution.
+	lag := float64(best)
+	for m := TempoRefineBeats; m >= 1; m-- {
+		centre := best * m
+		if centre+2 >= len(acf) {
+			continue
+		}
+		for _, k := range []int{centre - 1, centre + 1} {
+			if acf[k] > acf[centre] {
+				centre = k
+			}
+		}
+		lag = float64(centre)
+		a, b, c := acf[centre-1], acf[centre], acf[centre+1]
+		if denom := a - 2*b + c; denom < 0 {
+			lag += max(-0.5, min(0.5, 0.5*(a-c)/denom))
+		}
+		lag /= float64(m)
+		break
+	}
+	return 60 * FrameRate / lag
+}
+
+// Beats tracks the beats of the onset strength at a tempo in BPM by
+// dynamic programming (Ellis, 2007): every frame scores its own onset
+// strength plus the best score of a previous beat, less BeatTightness
+// times the squared log ratio of the interval to the beat period. The
+// best path ending in the last beat period is traced back.
+func Beats(strength []float64, bpm float64) []int {
+	if bpm <= 0 || len(strength) == 0 {
+		return nil
+	}
+	period := 60 * FrameRate / bpm
+
+	// Normalise and smooth the envelope with a Gaussian a sixteenth of a
+	// beat wide, so beats can sit slightly off the strongest frame.
+	local := make([]float64, len(strength))
+	sigma := max(period/16, 0.5)
+	radius := int(math.Ceil(3 * sigma))
+	std := stdDev(strength)
+	if std == 0 {
+		return nil
+	}
+	for t := range local {
+		for j := -radius; j <= radius; j++ {
+			if i := t + j; i >= 0 && i < len(strength) {
+				local[t] += strength[i] / std * math.Exp(-0.5*float64(j*j)/(sigma*sigma))
+			}
+		}
+	}
+
+	score := make([]float64, len(local))
+	backlink := make([]int, len(local))
+	for t := range local {
+		score[t], backlink[t] = local[t], -1
+		for prev := t - int(math.Round(2*period)); prev <= t-int(math.Round(period/2)); prev++ {
+			if prev < 0 {
+				continue
+			}
+			penalty := math.Log(float64(t-prev) / period)
+			if s := local[t] + score[prev] - BeatTightness*penalty*penalty; backlink[t] == -1 || s > score[t] {
+				score[t], backlink[t] = s, prev
+			}
+		}
+	}
+
+	last := len(score) - 1
+	for t := max(len(score)-int(math.Round(period)), 0); t < len(score); t++ {
+		if score[t] > score[last] {
+			last = t
+		}
+	}
+	var beats []int
+	for t := last; t >= 0; t = backlink[t] {
+		beats = append(beats, t)
+	}
+	for i, j := 0, len(beats)-1; i < j; i, j = i+1, j-1 {
+		beats[i], beats[j] = beats[j], beats[i]
+	}
+	return beats
+}
+
+func stdDev(values []float64) float64 {
+	mean, sq := 0.0, 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq / float64(len(values)))
+}
+
+// Metadata encodes the features as index.Track metadata: "tempo" in BPM
+// and "onsets" and "beats" as comma-separated times in seconds. Features
+// that were not found are left out.
+func (f *Features) Metadata() map[string]string {
+	m := map[string]string{}
+	if f.Tempo > 0 {
+		m["tempo"] = strconv.FormatFloat(f.Tempo, 'f', 2, 64)
+	}
+	if len(f.Onsets) > 0 {
+		m["onsets"] = formatTimes(f.Onsets)
+	}
+	if len(f.Beats) > 0 {
+		m["beats"] = formatTimes(f.Beats)
+	}
+	return m
+}
+
+// FromMetadata decodes features stored by Metadata. A missing tempo is
+// zero.
+func FromMetadata(m map[string]string) (*Features, error) {
+	tempo, hasTempo := m["tempo"]
+	_, hasOnsets := m["onsets"]
+	if !hasTempo && !hasOnsets {
+		return nil, errors.New("no features in metadata")
+	}
+	f := &Features{}
+	var err error
+	if hasTempo {
+		if f.Tempo, err = strconv.ParseFloat(tempo, 64); err != nil {
+			return nil, fmt.Errorf("tempo: %w", err)
+		}
+	}
+	if f.Onsets, err = parseTimes(m["onsets"]); err != nil {
+		return nil, fmt.Errorf("onsets: %w", err)
+	}
+	if f.Beats, err = parseTimes(m["beats"]); err != nil {
+		return nil, fmt.Errorf("beats: %w", err)
+	}
+	return f, nil
+}
+
+func formatTimes(times []float64) string {
+	parts := make([]string, len(times))
+	for i, t := range times {
+		parts[i] = strconv.FormatFloat(t, 'f', 3, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseTimes(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	times := make([]float64, len(parts))
+	for i, p := range parts {
+		t, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, err
+		}
+		times[i] = t
+	}
+	return times, nil
+}
@@ -0,0 +1,140 @@
+package feature_test
+
+import (
+	"fingerprint/feature"
+	"fingerprint/fingerprint"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// clicks renders decaying noise bursts at the given BPM over a quiet tone.
+func clicks(bpm, seconds float64, sampleRate int) ([]int16, []float64) {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int16, int(seconds*float64(sampleRate)))
+	var times []float64
+	period := 60 / bpm
+	for t := 0.25; t < seconds-0.1; t += period {
+		times = append(times, t)
+	}
+	for i := range samples {
+		x := float64(i) / float64(sampleRate)
+		v := 1000 * math.Sin(2*math.Pi*330*x)
+		for _, t := range times {
+			if d := x - t; d >= 0 && d < 0.08 {
+				v += 12000 * rng.NormFloat64() * math.Exp(-d/0.015)
+			}
+		}
+		samples[i] = int16(max(-32768, min(32767, v)))
+	}
+	return samples, times
+}
+
+func TestOnsets(t *testing.T) {
+	samples, times := clicks(100, 8, 44100)
+	f, err := feature.Extract(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first click falls before the first complete frame.
+	if len(f.Onsets) < len(times)-1 || len(f.Onsets) > len(times) {
+		t.Fatalf("expected an onset per click (%d), got %d: %v", len(times), len(f.Onsets), f.Onsets)
+	}
+	for _, onset := range f.Onsets {
+		nearest := math.Inf(1)
+		for _, click := range times {
+			nearest = min(nearest, math.Abs(onset-click))
+		}
+		if nearest > 0.05 {
+			t.Errorf("expected onset at %.3f s within 50 ms of a click", onset)
+		}
+	}
+}
+
+func TestExtractFromSpectrogram(t *testing.T) {
+	samples, _ := clicks(120, 6, 44100)
+	want, err := feature.Extract(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, useFloat32 := range []bool{false, true} {
+		result, err := fingerprint.Config{Float32: useFloat32, KeepSpectrogram: true}.Analyze(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := feature.ExtractFromSpectrogram(result.Spectrogram)
+		if len(got.Onsets) != len(want.Onsets) || math.Abs(got.Tempo-want.Tempo) > 0.01 {
+			t.Errorf("float32 %v: expected the features of Extract %+v, got %+v", useFloat32, want, got)
+		}
+	}
+	if result, _ := (fingerprint.Config{}).Analyze(samples, 44100); result.Spectrogram != nil {
+		t.Error("expected no spectrogram without KeepSpectrogram")
+	}
+}
+
+func TestTempoAndBeats(t *testing.T) {
+	for _, bpm := range []float64{90, 120, 150} {
+		samples, times := clicks(bpm, 12, 44100)
+		f, err := feature.Extract(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(f.Tempo-bpm) > 2 {
+			t.Errorf("%v BPM: expected tempo within 2 BPM, got %.2f", bpm, f.Tempo)
+		}
+		if len(f.Beats) < len(times)-2 {
+			t.Errorf("%v BPM: expected about %d beats, got %d", bpm, len(times), len(f.Beats))
+		}
+		for _, beat := range f.Beats {
+			nearest := math.Inf(1)
+			for _, click := range times {
+				nearest = min(nearest, math.Abs(beat-click))
+			}
+			if nearest > 0.07 {
+				t.Errorf("%v BPM: expected beat at %.3f s within 70 ms of a click", bpm, beat)
+				break
+			}
+		}
+	}
+}
+
+func TestNoTempo(t *testing.T) {
+	f, err := feature.Extract(make([]int16, 44100*3), 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Tempo != 0 || len(f.Onsets) != 0 || len(f.Beats) != 0 {
+		t.Errorf("expected no features for silence, got %+v", f)
+	}
+	if _, err := feature.Extract(make([]int16, 100), 8000); err == nil {
+		t.Error("expected error for a sample rate below the target rate")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	f := &feature.Features{Onsets: []float64{0.046, 0.65}, Tempo: 121.5, Beats: []float64{0.5, 1.0, 1.5}}
+	got, err := feature.FromMetadata(f.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, f) {
+		t.Errorf("expected %+v, got %+v", f, got)
+	}
+
+	// A tempo that was not found is not stored.
+	f = &feature.Features{Onsets: []float64{0.046}}
+	if _, ok := f.Metadata()["tempo"]; ok {
+		t.Errorf("expected no tempo in %v", f.Metadata())
+	}
+	if got, err := feature.FromMetadata(f.Metadata()); err != nil || !reflect.DeepEqual(got, f) {
+		t.Errorf("expected %+v, got %+v, %v", f, got, err)
+	}
+
+	if _, err := feature.FromMetadata(map[string]string{"originator": "Studio 2"}); err == nil {
+		t.Error("expected error for metadata without features")
+	}
+	if _, err := feature.FromMetadata(map[string]string{"tempo": "120", "beats": "0.5,x"}); err == nil {
+		t.Error("expected error for malformed beats")
+	}
+}
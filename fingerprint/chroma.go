@@ -0,0 +1,207 @@
+package fingerprint
+
+import (
+	"fingerprint/dsp"
+	"math"
+)
+
+const (
+	ChromaFrameSize = 4096   // Long frames resolve low notes (~2.7 Hz per bin).
+	ChromaHopSize   = 2048   // Hop size between chroma frames.
+	ChromaSmoothing = 4      // Frames averaged into one chroma vector (~0.74 s).
+	ChromaMinFreq   = 65.0   // Lowest frequency mapped to a pitch class (C2).
+	ChromaMaxFreq   = 4200.0 // Highest frequency mapped to a pitch class.
+)
+
+// ChromaVector is a pitch class profile: the energy of each of the 12
+// semitones of the octave, starting at C, normalised to unit length.
+type ChromaVector [12]float64
+
+// ChromaMatch describes the best alignment of a query to a reference.
+type ChromaMatch struct {
+	Shift int     // Semitones the query is transposed up to match the reference.
+	Cost  float64 // Mean cosine distance along the alignment path (0 is identical).
+	Start int     // First reference vector of the alignment.
+	End   int     // Last reference vector of the alignment.
+}
+
+// Chroma computes smoothed chroma vectors from audio samples. Because chroma
+// discards octave and timbre information, the result can be used to match
+// cover versions and live recordings with MatchChroma.
+func Chroma(samples []int16, sampleRate int) ([]ChromaVector, error) {
+	downsampled, err := downsample(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := dsp.Frame(downsampled, ChromaFrameSize, ChromaHopSize, dsp.PadNone)
+	if err != nil {
+		return nil, err
+	}
+
+	window := dsp.HammingWindow(ChromaFrameSize)
+
+	spectrogram := computeSpectrogram(frames, window)
+
+	chroma := chromaFromSpectrogram(spectrogram, TargetSampleRate, ChromaFrameSize)
+	return smoothChroma(chroma, ChromaSmoothing), nil
+}
+
+// chromaFromSpectrogram folds the energy of each FFT bin into the pitch class
+// of its nearest semitone.
+func chromaFromSpectrogram(spectrogram [][]float64, sampleRate, frameSize int) []ChromaVector {
+	binHz := float64(sampleRate) / float64(frameSize)
+	classes := make([]int, frameSize/2+1)
+	for k := range classes {
+		freq := float64(k) * binHz
+		if freq < ChromaMinFreq || freq > ChromaMaxFreq {
+			classes[k] = -1
+			continue
+		}
+		midi := int(math.Round(12*math.Log2(freq/440) + 69))
+		classes[k] = midi % 12
+	}
+
+	chroma := make([]ChromaVector, len(spectrogram))
+	for i, frame := range spectrogram {
+		for k, mag := range frame {
+			if k < len(classes) && classes[k] >= 0 {
+				chroma[i][classes[k]] += mag * mag
+			}
+		}
+		chroma[i].normalize()
+	}
+	return chroma
+}
+
+// smoothChroma averages every n consecutive vectors into one, which reduces
+// the work for MatchChroma and evens out short transients.
+func smoothChroma(chroma []ChromaVector, n int) []ChromaVector {
+	if n <= 1 {
+		return chroma
+	}
+	smoothed := make([]ChromaVector, 0, len(chroma)/n+1)
+	for start := 0; start < len(chroma); start += n {
+		var v ChromaVector
+		for _, c := range chroma[start:min(start+n, len(chroma))] {
+			for p := range v {
+				v[p] += c[p]
+			}
+		}
+		v.normalize()
+		smoothed = append(smoothed, v)
+	}
+	return smoothed
+}
+
+func (v *ChromaVector) normalize() {
+	sum := 0.0
+	for _, x := range v {
+		sum += x * x
+	}
+	if sum == 0 {
+		return
+	}
+	norm := math.Sqrt(sum)
+	for p := range v {
+		v[p] /= norm
+	}
+}
+
+// Transpose returns the vector shifted up by the given number of semitones.
+func (v ChromaVector) Transpose(semitones int) ChromaVector {
+	var out ChromaVector
+	for p := range v {
+		out[((p+semitones)%12+12)%12] = v[p]
+	}
+	return out
+}
+
+// chromaDistance is the cosine distance between two unit chroma vectors.
+// Silent (all-zero) vectors only match each other.
+func chromaDistance(a, b ChromaVector) float64 {
+	dot, na, nb := 0.0, 0.0, 0.0
+	for p := range a {
+		dot += a[p] * b[p]
+		na += a[p] * a[p]
+		nb += b[p] * b[p]
+	}
+	if na == 0 || nb == 0 {
+		if na == nb {
+			return 0
+		}
+		return 1
+	}
+	return 1 - dot
+}
+
+// MatchChroma aligns the query anywhere inside the reference with subsequence
+// dynamic time warping, trying all 12 transpositions of the query. Time
+// warping absorbs tempo differences; transposition handles key changes.
+func MatchChroma(query, reference []ChromaVector) ChromaMatch {
+	best := ChromaMatch{Shift: -1, Cost: math.Inf(1), Start: -1, End: -1}
+	if len(query) == 0 || len(reference) == 0 {
+		return best
+	}
+	for shift := 0; shift < 12; shift++ {
+		transposed := make([]ChromaVector, len(query))
+		for i, v := range query {
+			transposed[i] = v.Transpose(shift)
+		}
+		m := subsequenceDTW(transposed, reference)
+		if m.Cost < best.Cost {
+			m.Shift = shift
+			best = m
+		}
+	}
+	return best
+}
+
+// subsequenceDTW finds the cheapest warping path that covers the whole query
+// and any contiguous part of the reference. Only two rows of the cost matrix
+// are kept; the start of each path is carried along instead of backtracking.
+func subsequenceDTW(query, reference []ChromaVector) ChromaMatch {
+	m := len(reference)
+	cost := make([]float64, m)
+	length := make([]int, m)
+	start := make([]int, m)
+	prevCost := make([]float64, m)
+	prevLength := make([]int, m)
+	prevStart := make([]int, m)
+
+	for j := 0; j < m; j++ {
+		prevCost[j] = chromaDistance(query[0], reference[j])
+		prevLength[j] = 1
+		prevStart[j] = j
+	}
+	for i := 1; i < len(query); i++ {
+		for j := 0; j < m; j++ {
+			d := chromaDistance(query[i], reference[j])
+			// Vertical step: next query vector, same reference vector.
+			c, l, s := prevCost[j], prevLength[j], prevStart[j]
+			if j > 0 {
+				if prevCost[j-1] <= c {
+					c, l, s = prevCost[j-1], prevLength[j-1], prevStart[j-1]
+				}
+				if cost[j-1] < c {
+					c, l, s = cost[j-1], length[j-1], start[j-1]
+				}
+			}
+			cost[j], length[j], start[j] = c+d, l+1, s
+		}
+		cost, prevCost = prevCost, cost
+		length, prevLength = prevLength, length
+		start, prevStart = prevStart, start
+	}
+
+	match := ChromaMatch{Cost: math.Inf(1)}
+	for j := 0; j < m; j++ {
+		mean := prevCost[j] / float64(prevLength[j])
+		if mean < match.Cost {
+			match.Cost = mean
+			match.Start = prevStart[j]
+			match.End = j
+		}
+	}
+	return match
+}
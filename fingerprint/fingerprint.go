@@ -3,6 +3,9 @@ package fingerprint
 import (
 	"errors"
 	"fingerprint/dsp"
+	"fmt"
+	"math"
+	"slices"
 )
 
 const (
@@ -12,37 +15,375 @@ const (
 	HopSize          = 512   // Hop size for overlapping frames.
 	NumBands         = 6     // Number of frequency bands for peak detection.
 	TargetZoneFrames = 20    // Maximum frame difference for pairing peaks.
+	TripletFanOut    = 10    // Peaks combined with each anchor for triplet hashes.
 )
 
+const (
+	BandTransition  = 100.0 // Transition width in Hz of the band-limiting filter.
+	BandAttenuation = 60.0  // Stopband attenuation in dB of the band-limiting filter.
+	LogBandMinFreq  = 100.0 // Lowest peak band edge in Hz on a log scale.
+)
+
+const (
+	GateMargin     = 6.0   // dB above the noise floor below which a frame is silent.
+	GateRange      = 30.0  // dB below the loud level below which a frame may be silent.
+	GateMinLevel   = -70.0 // dBFS below which a frame is always silent.
+	GatePercentile = 10.0  // Percentile of frame levels taken as the noise floor.
+	GateLoudLevel  = 90.0  // Percentile of frame levels taken as the loud level.
+)
+
+// Config selects optional stages of the fingerprinting pipeline. The zero
+// value, returned by DefaultConfig, is the pipeline used by Fingerprint, so
+// hashes in existing indexes stay valid.
+type Config struct {
+	// BandLow and BandHigh band-limit the downsampled signal, in Hz, with
+	// a Kaiser-window filter. An edge of zero is not filtered, so BandLow
+	// alone removes DC rumble. 300 and 5000 keep the range that survives
+	// telephone lines and low-bitrate codecs.
+	BandLow, BandHigh float64
+
+	// PreEmphasis is the coefficient of a first-order pre-emphasis filter
+	// applied before framing, which tilts the spectrum towards the high
+	// bands where peaks are sparser. Typical values are 0.95 to 0.97; zero
+	// disables it.
+	PreEmphasis float64
+
+	// Window is the analysis window applied to every frame before the
+	// FFT. The zero value is the Hamming window of the default pipeline.
+	// Windows with lower side lobes, such as Blackman-Harris, keep strong
+	// peaks from leaking into neighbouring bins.
+	Window dsp.Window
+
+	// Padding selects how the signal is framed at its edges. The zero
+	// value, dsp.PadNone, drops the trailing partial frame; dsp.PadCentre
+	// and dsp.PadReflect centre frame t on sample t*HopSize and keep the
+	// end of the signal.
+	Padding dsp.Padding
+
+	// BandScale spaces the NumBands peak detection bands on a frequency
+	// scale. The zero value, dsp.ScaleLinear, gives equal-width bands, of
+	// which four cover the often noisy 2.7-5.5 kHz region; dsp.ScaleMel,
+	// dsp.ScaleBark and dsp.ScaleLog (from LogBandMinFreq) give narrower
+	// bands at low frequencies, where most musical content lies.
+	BandScale dsp.Scale
+
+	// Interpolation refines the frequency and magnitude of every peak
+	// between FFT bins. The zero value, InterpolateNone, keeps both at
+	// the peak bin.
+	Interpolation Interpolation
+
+	// HashFreqStep quantises the refined peak frequencies in the pair
+	// hashes to steps of this many Hz instead of hashing the FFT bin.
+	// Steps under 11 Hz clip the highest frequencies to the 9 bits of a
+	// hash frequency. Zero hashes the bin.
+	HashFreqStep float64
+
+	// Gate marks frames whose RMS level falls below the noise floor of the
+	// recording as silent and drops their peaks, so dead air and room
+	// noise do not fill the index with hashes that match everything.
+	// Analyze reports the silent regions.
+	Gate bool
+
+	// TargetLoudness normalises the audio to this integrated loudness in
+	// LUFS (EBU R128 uses -23) before the spectrogram, so peak magnitudes
+	// and the silence gate do not depend on the input gain. Zero disables
+	// it. MeasureLoudness measures the loudness without normalising.
+	TargetLoudness  float64
+	MeasureLoudness bool
+
+	// Float32 runs the pipeline in float32 for bulk ingestion: the audio
+	// is resampled straight from 16-bit samples and the spectrogram is
+	// one contiguous float32 buffer, recycled between calls, so it
+	// allocates about a twentieth of the memory. Peak magnitudes differ
+	// from the float64 pipeline by float32 rounding, about 1e-7 of the
+	// loudest bin of a frame, and the hashes differ where two bins of a
+	// band are that close: about one peak in 10000 of music, but most of
+	// the peaks of digital silence after BandLow, BandHigh or PreEmphasis,
+	// which Gate drops. The loudness and filter stages still run in
+	// float64 on the downsampled signal.
+	Float32 bool
+
+	// KeepSpectrogram returns the magnitude spectrogram the peaks were
+	// picked from in Result.Spectrogram, so that other features can be
+	// computed without a second pass. With Float32 it is a float64 copy.
+	KeepSpectrogram bool
+}
+
+// Result is the outcome of Analyze: the peak constellation of the audio
+// together with what was measured on the way.
+type Result struct {
+	Peaks []Peak
+
+	// Silence lists the runs of frames gated as silent, and NoiseFloor
+	// the estimated noise floor in dBFS, which is minus infinity if every
+	// frame is below GateMinLevel. Both are only set with Gate.
+	Silence    []Region
+	NoiseFloor float64
+
+	// Loudness is the integrated loudness of the input in LUFS, measured
+	// with TargetLoudness or MeasureLoudness before any normalisation.
+	Loudness float64
+
+	// Spectrogram is the magnitude spectrogram of the audio, only set
+	// with KeepSpectrogram.
+	Spectrogram [][]float64
+}
+
+// DefaultConfig returns the configuration used by the package-level
+// functions.
+func DefaultConfig() Config {
+	return Config{}
+}
+
 func Fingerprint(samples []int16, sampleRate int) ([]uint32, error) {
-	if sampleRate < TargetSampleRate {
-		return nil, errors.New("sample rate is lower than target sample rate")
+	return DefaultConfig().Fingerprint(samples, sampleRate)
+}
+
+// FingerprintTriplets generates tempo-invariant triplet hashes from audio samples.
+func FingerprintTriplets(samples []int16, sampleRate int) ([]uint32, error) {
+	return DefaultConfig().FingerprintTriplets(samples, sampleRate)
+}
+
+// ExtractPeaks downsamples the audio, computes its spectrogram and returns
+// the peak constellation that the hashers work on.
+func ExtractPeaks(samples []int16, sampleRate int) ([]Peak, error) {
+	return DefaultConfig().ExtractPeaks(samples, sampleRate)
+}
+
+// Spectrogram downsamples the audio and returns the magnitude spectrum of
+// every windowed frame, as used for peak detection.
+func Spectrogram(samples []int16, sampleRate int) ([][]float64, error) {
+	return DefaultConfig().Spectrogram(samples, sampleRate)
+}
+
+// Fingerprint generates landmark hashes from audio samples.
+func (c Config) Fingerprint(samples []int16, sampleRate int) ([]uint32, error) {
+	peaks, err := c.ExtractPeaks(samples, sampleRate)
+	if err != nil {
+		return nil, err
 	}
-	n := len(samples)
-	floatSamples := make([]float64, n)
-	for i, s := range samples {
-		floatSamples[i] = float64(s) / 32768.0
+
+	landmarks := c.Landmarks(peaks)
+	hashes := make([]uint32, len(landmarks))
+	for i, l := range landmarks {
+		hashes[i] = l.Hash
+	}
+	return hashes, nil
+}
+
+// Landmarks pairs the peaks returned by ExtractPeaks and hashes them with
+// the frequency quantisation of the configuration.
+func (c Config) Landmarks(peaks []Peak) []Landmark {
+	return QuantizedLandmarks(peaks, TargetZoneFrames, c.HashFreqStep)
+}
+
+// FingerprintTriplets generates tempo-invariant triplet hashes from audio samples.
+func (c Config) FingerprintTriplets(samples []int16, sampleRate int) ([]uint32, error) {
+	peaks, err := c.ExtractPeaks(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := HashTriplets(peaks, TargetZoneFrames, TripletFanOut)
+	return hashes, nil
+}
+
+// ExtractPeaks returns the peak constellation of the audio.
+func (c Config) ExtractPeaks(samples []int16, sampleRate int) ([]Peak, error) {
+	result, err := c.Analyze(samples, sampleRate)
+	if err != nil {
+		return nil, err
 	}
+	return result.Peaks, nil
+}
 
-	cutoff := float64(TargetSampleRate) / 2.0
-	kernel := dsp.GenerateLowPassKernel(cutoff, sampleRate, FilterTaps)
+// Analyze runs the pipeline and returns the peaks of the audio along with
+// the measurements of the optional stages.
+func (c Config) Analyze(samples []int16, sampleRate int) (*Result, error) {
+	if c.Float32 {
+		return c.analyze32(samples, sampleRate)
+	}
+	signal, loudness, err := c.prepare(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	spectrogram, err := c.spectrogram(signal)
+	if err != nil {
+		return nil, err
+	}
 
-	filtered := dsp.ApplyFIRFilter(floatSamples, kernel)
+	edges, err := c.peakBands()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Loudness: loudness}
+	if c.KeepSpectrogram {
+		result.Spectrogram = spectrogram
+	}
+	peaks := DetectPeaksInBands(spectrogram, edges)
+	if c.Gate {
+		levels, err := dsp.FrameRMS(signal, FrameSize, HopSize, c.Padding)
+		if err != nil {
+			return nil, err
+		}
+		peaks = result.gate(peaks, levels)
+	}
+	result.Peaks = RefinePeaks(spectrogram, peaks, c.Interpolation, float64(TargetSampleRate)/FrameSize)
+	return result, nil
+}
+
+// gate drops the peaks of the frames that the levels gate as silent and
+// records the silence and noise floor.
+func (r *Result) gate(peaks []Peak, levels []float64) []Peak {
+	var silent []bool
+	silent, r.NoiseFloor = gate(levels)
+	r.Silence = silentRegions(silent)
+	return slices.DeleteFunc(peaks, func(p Peak) bool { return silent[p.FrameIndex] })
+}
 
-	decimationFactor := sampleRate / TargetSampleRate
-	downsampled := make([]float64, 0, len(filtered)/decimationFactor)
-	for i := 0; i < len(filtered); i += decimationFactor {
-		downsampled = append(downsampled, filtered[i])
+// peakBands returns the bin edges of the peak detection bands.
+func (c Config) peakBands() ([]int, error) {
+	numBins := FrameSize/2 + 1
+	if c.BandScale == dsp.ScaleLinear {
+		return linearBandEdges(numBins, NumBands), nil
+	}
+
+	low := 0.0
+	if c.BandScale == dsp.ScaleLog {
+		low = LogBandMinFreq
+	}
+	hz, err := dsp.BandEdges(c.BandScale, low, float64(TargetSampleRate)/2, NumBands)
+	if err != nil {
+		return nil, err
 	}
+	edges := make([]int, len(hz))
+	for i, f := range hz {
+		edges[i] = int(math.Round(f * FrameSize / TargetSampleRate))
+		if i > 0 {
+			// Keep every band at least one bin wide.
+			edges[i] = max(edges[i], edges[i-1]+1)
+		}
+	}
+	edges[NumBands] = numBins
+	return edges, nil
+}
 
-	frames := frameSignal(downsampled, FrameSize, HopSize)
+// Spectrogram returns the magnitude spectrum of every frame of the audio.
+func (c Config) Spectrogram(samples []int16, sampleRate int) ([][]float64, error) {
+	signal, _, err := c.prepare(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return c.spectrogram(signal)
+}
 
-	window := hammingWindow(FrameSize)
+// prepare downsamples the audio and applies the gain and filters of the
+// configuration, giving the signal that is framed. It also returns the
+// loudness of the audio if it was measured.
+func (c Config) prepare(samples []int16, sampleRate int) ([]float64, float64, error) {
+	downsampled, err := downsample(samples, sampleRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.condition(downsampled, samples, sampleRate)
+}
 
-	spectrogram := computeSpectrogram(frames, window)
+// condition applies the gain and filters of the configuration to the
+// downsampled signal. The loudness is measured on the original samples.
+func (c Config) condition(downsampled []float64, samples []int16, sampleRate int) ([]float64, float64, error) {
+	var err error
+	loudness := 0.0
+	if c.TargetLoudness != 0 || c.MeasureLoudness {
+		loudness = measureLoudness(samples, sampleRate)
+	}
+	if c.TargetLoudness != 0 && !math.IsInf(loudness, -1) {
+		// The pipeline is floating point, so a gain above full scale
+		// does not clip.
+		gain := math.Pow(10, (c.TargetLoudness-loudness)/20)
+		for i := range downsampled {
+			downsampled[i] *= gain
+		}
+	}
 
-	peaks := DetectPeaks(spectrogram, NumBands)
+	downsampled, err = c.bandLimit(downsampled)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.PreEmphasis != 0 {
+		downsampled = dsp.NewPreEmphasis(c.PreEmphasis).Process(downsampled)
+	}
+	return downsampled, loudness, nil
+}
 
-	hashes := HashFingerprint(peaks, TargetZoneFrames)
-	return hashes, nil
+// measureLoudness returns the integrated loudness of the samples, measured
+// at the input rate, where the K-weighting sees the whole spectrum.
+func measureLoudness(samples []int16, sampleRate int) float64 {
+	floatSamples := make([]float64, len(samples))
+	for i, s := range samples {
+		floatSamples[i] = float64(s) / 32768.0
+	}
+	return dsp.IntegratedLoudness(floatSamples, sampleRate)
+}
+
+// spectrogram frames and windows the prepared signal and returns the
+// magnitude spectrum of every frame.
+func (c Config) spectrogram(signal []float64) ([][]float64, error) {
+	window, err := c.Window.Coefficients(FrameSize)
+	if err != nil {
+		return nil, err
+	}
+	if c.Padding < dsp.PadNone || c.Padding > dsp.PadReflect {
+		return nil, fmt.Errorf("unknown padding %d", c.Padding)
+	}
+
+	frames, err := dsp.Frame(signal, FrameSize, HopSize, c.Padding)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeSpectrogram(frames, window), nil
+}
+
+// bandLimit applies the filter selected by BandLow and BandHigh to the
+// downsampled signal.
+func (c Config) bandLimit(signal []float64) ([]float64, error) {
+	spec := dsp.FilterSpec{
+		Transition:  BandTransition,
+		Attenuation: BandAttenuation,
+		SampleRate:  TargetSampleRate,
+	}
+	switch {
+	case c.BandLow > 0 && c.BandHigh > 0:
+		spec.Type, spec.Low, spec.High = dsp.BandPass, c.BandLow, c.BandHigh
+	case c.BandLow > 0:
+		spec.Type, spec.Cutoff = dsp.HighPass, c.BandLow
+	case c.BandHigh > 0:
+		spec.Type, spec.Cutoff = dsp.LowPass, c.BandHigh
+	default:
+		return signal, nil
+	}
+	kernel, err := dsp.DesignKaiser(spec)
+	if err != nil {
+		return nil, err
+	}
+	return dsp.Convolve(signal, kernel, dsp.BoundaryZero), nil
+}
+
+// downsample converts samples to float64, low-pass filters them and
+// resamples the result to TargetSampleRate.
+func downsample(samples []int16, sampleRate int) ([]float64, error) {
+	if sampleRate < TargetSampleRate {
+		return nil, errors.New("sample rate is lower than target sample rate")
+	}
+	n := len(samples)
+	floatSamples := make([]float64, n)
+	for i, s := range samples {
+		floatSamples[i] = float64(s) / 32768.0
+	}
+
+	// A polyphase resampler low-passes at TargetSampleRate/2 and computes
+	// only the samples that are kept. Rates of 88.2 kHz and up are first
+	// halved in cheap stages.
+	resampler := dsp.NewMultiStageResampler(sampleRate, TargetSampleRate, FilterTaps)
+	return resampler.Resample(floatSamples), nil
 }
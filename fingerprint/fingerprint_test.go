@@ -1,8 +1,14 @@
 package fingerprint
 
 import (
+	"bytes"
+	"fingerprint/dsp"
+	"image/color"
+	"image/png"
 	"math"
+	"math/rand"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -243,3 +249,841 @@ func TestFingerprint_ConstantSignal(t *testing.T) {
 		t.Errorf("expected non-zero number of hashes for constant signal, got 0")
 	}
 }
+
+func TestHashTriplets(t *testing.T) {
+	peaks := []Peak{
+		{FrameIndex: 0, FreqBin: 100},
+		{FrameIndex: 2, FreqBin: 200},
+		{FrameIndex: 4, FreqBin: 50},
+	}
+
+	hashes := HashTriplets(peaks, 10, 5)
+	if len(hashes) != 1 {
+		t.Fatalf("expected 1 hash, got %d", len(hashes))
+	}
+
+	// One octave up, one octave down, second peak half way to the third.
+	expected := uint32((512+32)<<22 | (512-32)<<12 | 0x800)
+	if hashes[0] != expected {
+		t.Errorf("expected 0x%08X, got 0x%08X", expected, hashes[0])
+	}
+}
+
+func TestHashTriplets_TempoInvariant(t *testing.T) {
+	// Frames on a grid of 4 so that every scaling below stays integral.
+	peaks := []Peak{
+		{FrameIndex: 0, FreqBin: 40},
+		{FrameIndex: 4, FreqBin: 120},
+		{FrameIndex: 8, FreqBin: 80},
+		{FrameIndex: 12, FreqBin: 160},
+	}
+	scale := func(peaks []Peak, frames, bins float64) []Peak {
+		scaled := make([]Peak, len(peaks))
+		for i, p := range peaks {
+			scaled[i] = Peak{FrameIndex: int(float64(p.FrameIndex) * frames), FreqBin: int(float64(p.FreqBin) * bins)}
+		}
+		return scaled
+	}
+
+	original := HashTriplets(peaks, 30, 10)
+	if len(original) == 0 {
+		t.Fatal("expected triplet hashes, got none")
+	}
+	tests := []struct {
+		name         string
+		frames, bins float64
+	}{
+		// Playing twice as fast halves the frame indices and doubles the bins.
+		{"twice as fast", 0.5, 2},
+		{"slowed down", 1.5, 1},
+		{"transposed", 1, 3},
+	}
+	for _, tc := range tests {
+		got := HashTriplets(scale(peaks, tc.frames, tc.bins), 30, 10)
+		if !reflect.DeepEqual(got, original) {
+			t.Errorf("%s: expected identical hashes %v, got %v", tc.name, original, got)
+		}
+	}
+
+	// Changing a time or frequency ratio changes the hash.
+	moved := slices.Clone(peaks)
+	moved[1].FrameIndex = 6
+	if got := HashTriplets(moved, 30, 10); got[0] == original[0] {
+		t.Errorf("expected a different time ratio to change hash 0x%08X", got[0])
+	}
+	detuned := slices.Clone(peaks)
+	detuned[1].FreqBin = 100
+	if got := HashTriplets(detuned, 30, 10); got[0] == original[0] {
+		t.Errorf("expected a different frequency ratio to change hash 0x%08X", got[0])
+	}
+}
+
+func TestHashTriplets_Limits(t *testing.T) {
+	peaks := []Peak{
+		{FrameIndex: 0, FreqBin: 100},
+		{FrameIndex: 1, FreqBin: 0}, // DC bins are skipped.
+		{FrameIndex: 2, FreqBin: 110},
+		{FrameIndex: 3, FreqBin: 120},
+		{FrameIndex: 4, FreqBin: 130},
+		{FrameIndex: 50, FreqBin: 140}, // Outside the target zone.
+	}
+
+	// fanOut of 2 leaves a single triplet per anchor with two later peaks.
+	hashes := HashTriplets(peaks, 10, 2)
+	if len(hashes) != 2 {
+		t.Errorf("expected 2 hashes, got %d", len(hashes))
+	}
+}
+
+func TestSubFingerprints(t *testing.T) {
+	// Three bands from bins [0,1), [1,2), [2,3), giving two bits per frame.
+	edges := []int{0, 1, 2, 3}
+	spectrogram := [][]float64{
+		{1, 1, 1},
+		{3, 1, 1}, // Band 0 gains energy relative to band 1.
+		{3, 1, 2}, // Band 2 gains energy relative to band 1.
+	}
+
+	subs := subFingerprints(spectrogram, edges)
+	expected := []uint32{1 << 31, 0}
+	if !reflect.DeepEqual(subs, expected) {
+		t.Errorf("expected %032b, got %032b", expected, subs)
+	}
+}
+
+func TestBitErrorRate(t *testing.T) {
+	a := []uint32{0xFFFFFFFF, 0x00000000}
+	b := []uint32{0xFFFF0000, 0x00000000}
+	if ber := BitErrorRate(a, b); !almostEqualSlices([]float64{ber}, []float64{0.25}, 1e-9) {
+		t.Errorf("expected BER 0.25, got %f", ber)
+	}
+	if ber := BitErrorRate(nil, b); ber != 1 {
+		t.Errorf("expected BER 1 for empty input, got %f", ber)
+	}
+}
+
+func TestMatchSubFingerprints(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int16, TargetSampleRate*4)
+	for i := range samples {
+		samples[i] = int16(rng.NormFloat64() * 4000)
+	}
+	reference, err := SubFingerprint(samples, TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Take a noisy one second excerpt aligned to a hop boundary.
+	const startFrame = 100
+	start := startFrame * SubFingerprintHopSize
+	excerpt := make([]int16, TargetSampleRate)
+	for i := range excerpt {
+		excerpt[i] = samples[start+i] + int16(rng.NormFloat64()*400)
+	}
+	query, err := SubFingerprint(excerpt, TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	offset, ber, ok := MatchSubFingerprints(query, reference)
+	if !ok {
+		t.Fatalf("expected a match, best BER was %f", ber)
+	}
+	if offset != startFrame {
+		t.Errorf("expected offset %d, got %d", startFrame, offset)
+	}
+
+	if _, _, ok := MatchSubFingerprints(reference, query); ok {
+		t.Error("expected no match for a query longer than the reference")
+	}
+}
+
+// melody synthesises a sequence of MIDI notes as sine tones at TargetSampleRate.
+func melody(notes []int, noteSeconds float64) []int16 {
+	noteLen := int(noteSeconds * TargetSampleRate)
+	samples := make([]int16, 0, len(notes)*noteLen)
+	for _, note := range notes {
+		freq := 440 * math.Pow(2, float64(note-69)/12)
+		for i := 0; i < noteLen; i++ {
+			phase := 2 * math.Pi * freq * float64(i) / TargetSampleRate
+			samples = append(samples, int16(8000*math.Sin(phase)))
+		}
+	}
+	return samples
+}
+
+func TestChromaPitchClass(t *testing.T) {
+	// A4 (440 Hz) belongs to pitch class 9 when counting from C.
+	chroma, err := Chroma(melody([]int{69}, 2), TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chroma) == 0 {
+		t.Fatal("expected chroma vectors, got none")
+	}
+	for i, v := range chroma {
+		maxClass := 0
+		for p := range v {
+			if v[p] > v[maxClass] {
+				maxClass = p
+			}
+		}
+		if maxClass != 9 {
+			t.Errorf("vector %d: expected pitch class 9, got %d", i, maxClass)
+		}
+	}
+}
+
+func TestChromaTranspose(t *testing.T) {
+	var v ChromaVector
+	v[11] = 1
+	if got := v.Transpose(2); got[1] != 1 {
+		t.Errorf("expected B transposed up 2 semitones to be C#, got %v", got)
+	}
+	if got := v.Transpose(-11); got[0] != 1 {
+		t.Errorf("expected B transposed down 11 semitones to be C, got %v", got)
+	}
+}
+
+func TestMatchChroma(t *testing.T) {
+	tune := []int{60, 64, 67, 72, 65, 69, 62, 67, 60, 71, 64, 60}
+	reference, err := Chroma(append(melody([]int{50, 52, 53}, 1), melody(tune, 1)...), TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A cover three semitones higher and 25% slower.
+	cover := make([]int, len(tune))
+	for i, n := range tune {
+		cover[i] = n + 3
+	}
+	query, err := Chroma(melody(cover, 1.25), TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	match := MatchChroma(query, reference)
+	if match.Shift != 9 {
+		t.Errorf("expected shift 9, got %d", match.Shift)
+	}
+
+	other, err := Chroma(melody([]int{61, 66, 61, 66, 70, 63, 70, 63, 68, 61, 68, 66}, 1.25), TargetSampleRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unrelated := MatchChroma(other, reference); unrelated.Cost <= match.Cost {
+		t.Errorf("expected unrelated melody to cost more than %f, got %f", match.Cost, unrelated.Cost)
+	}
+}
+
+func TestLandmarks(t *testing.T) {
+	peaks := []Peak{
+		{FrameIndex: 10, FreqBin: 50},
+		{FrameIndex: 12, FreqBin: 300},
+		{FrameIndex: 13, FreqBin: 400},
+	}
+	landmarks := Landmarks(peaks, 5)
+	hashes := HashFingerprint(peaks, 5)
+	if len(landmarks) != len(hashes) {
+		t.Fatalf("expected %d landmarks, got %d", len(hashes), len(landmarks))
+	}
+	for i, l := range landmarks {
+		if l.Hash != hashes[i] {
+			t.Errorf("landmark %d: expected hash 0x%08X, got 0x%08X", i, hashes[i], l.Hash)
+		}
+	}
+	if landmarks[1].Anchor != peaks[0] || landmarks[1].Target != peaks[2] {
+		t.Errorf("landmark 1: unexpected pair %v", landmarks[1])
+	}
+}
+
+func TestRenderConstellation(t *testing.T) {
+	spectrogram := make([][]float64, 20)
+	for i := range spectrogram {
+		spectrogram[i] = make([]float64, 11)
+		spectrogram[i][i%11] = 1
+	}
+	peaks := []Peak{
+		{FrameIndex: 2, FreqBin: 2},
+		{FrameIndex: 12, FreqBin: 2},
+	}
+	landmarks := Landmarks(peaks, 20)
+
+	var buf bytes.Buffer
+	if err := RenderConstellation(&buf, spectrogram, peaks, landmarks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 11 {
+		t.Fatalf("expected 20x11 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	// Bin 2 is drawn at row 8 since low frequencies are at the bottom.
+	if c := color.RGBAModel.Convert(img.At(2, 8)); c != peakColor {
+		t.Errorf("expected peak colour at anchor, got %v", c)
+	}
+	if c := color.RGBAModel.Convert(img.At(7, 8)); c != pairColor {
+		t.Errorf("expected pair colour between peaks, got %v", c)
+	}
+	if c := color.RGBAModel.Convert(img.At(19, 0)); c != heatColor(0) {
+		t.Errorf("expected background colour for silent bin, got %v", c)
+	}
+}
+
+func TestSpectrogram_NonIntegerRate(t *testing.T) {
+	tone := func(sampleRate int) []int16 {
+		samples := make([]int16, sampleRate)
+		for i := range samples {
+			samples[i] = int16(10000 * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate)))
+		}
+		return samples
+	}
+
+	// 1 kHz lands in the same bin whether the input is 44.1 or 48 kHz.
+	for _, rate := range []int{44100, 48000} {
+		spectrogram, err := Spectrogram(tone(rate), rate)
+		if err != nil {
+			t.Fatalf("%d Hz: unexpected error: %v", rate, err)
+		}
+		frame := spectrogram[len(spectrogram)/2]
+		maxBin := 0
+		for j := range frame {
+			if frame[j] > frame[maxBin] {
+				maxBin = j
+			}
+		}
+		want := int(math.Round(1000.0 * FrameSize / TargetSampleRate))
+		if maxBin != want {
+			t.Errorf("%d Hz: expected peak in bin %d, got %d", rate, want, maxBin)
+		}
+		wantFrames := (TargetSampleRate-FrameSize)/HopSize + 1
+		if len(spectrogram) != wantFrames {
+			t.Errorf("%d Hz: expected %d frames, got %d", rate, wantFrames, len(spectrogram))
+		}
+	}
+}
+
+func TestConfig_BandLimit(t *testing.T) {
+	// A 60 Hz hum under a 1 kHz tone.
+	samples := make([]int16, 44100)
+	for i := range samples {
+		x := float64(i) / 44100
+		samples[i] = int16(8000*math.Sin(2*math.Pi*60*x) + 4000*math.Sin(2*math.Pi*1000*x))
+	}
+	binOf := func(freq float64) int { return int(math.Round(freq * FrameSize / TargetSampleRate)) }
+
+	plain, err := Spectrogram(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := Config{BandLow: 300, BandHigh: 5000}.Spectrogram(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := len(plain) / 2
+	hum := binOf(60)
+	if ratio := limited[mid][hum] / plain[mid][hum]; ratio > 0.01 {
+		t.Errorf("expected the hum to drop by 40 dB, got a ratio of %f", ratio)
+	}
+	tone := binOf(1000)
+	if ratio := limited[mid][tone] / plain[mid][tone]; math.Abs(ratio-1) > 0.01 {
+		t.Errorf("expected the tone to pass unchanged, got a ratio of %f", ratio)
+	}
+
+	// The zero value is the default pipeline.
+	want, err := Fingerprint(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Config{}.Fingerprint(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("expected the zero Config to match Fingerprint")
+	}
+
+	if _, err := (Config{BandHigh: 6000}).Spectrogram(samples, 44100); err == nil {
+		t.Error("expected error for a band edge above Nyquist")
+	}
+}
+
+func TestConfig_PreEmphasis(t *testing.T) {
+	// Equal 200 Hz and 4 kHz tones.
+	samples := make([]int16, 44100)
+	for i := range samples {
+		x := float64(i) / 44100
+		samples[i] = int16(6000*math.Sin(2*math.Pi*200*x) + 6000*math.Sin(2*math.Pi*4000*x))
+	}
+	binOf := func(freq float64) int { return int(math.Round(freq * FrameSize / TargetSampleRate)) }
+
+	plain, err := Spectrogram(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emphasised, err := Config{PreEmphasis: 0.97}.Spectrogram(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := len(plain) / 2
+	low, high := binOf(200), binOf(4000)
+	before := plain[mid][high] / plain[mid][low]
+	after := emphasised[mid][high] / emphasised[mid][low]
+	if after < 10*before {
+		t.Errorf("expected the high tone to gain over 20 dB on the low one, ratio went from %f to %f", before, after)
+	}
+}
+
+func TestConfig_Window(t *testing.T) {
+	samples := make([]int16, 44100)
+	for i := range samples {
+		samples[i] = int16(12000 * math.Sin(2*math.Pi*1000*float64(i)/44100))
+	}
+	tone := int(math.Round(1000.0 * FrameSize / TargetSampleRate))
+
+	// Leakage ten bins away from the tone, relative to the tone.
+	leakage := func(c Config) float64 {
+		spectrogram, err := c.Spectrogram(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := spectrogram[len(spectrogram)/2]
+		return frame[tone+10] / frame[tone]
+	}
+	hamming := leakage(Config{})
+	harris := leakage(Config{Window: dsp.Window{Type: dsp.WindowBlackmanHarris}})
+	if harris > hamming/10 {
+		t.Errorf("expected Blackman-Harris to leak 20 dB less than Hamming, got %g and %g", harris, hamming)
+	}
+
+	if _, err := (Config{Window: dsp.Window{Type: dsp.WindowKaiser, Beta: -1}}).Spectrogram(samples, 44100); err == nil {
+		t.Error("expected error for an invalid window")
+	}
+}
+
+func TestConfig_Padding(t *testing.T) {
+	samples := make([]int16, 44100)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/44100))
+	}
+	// One second at TargetSampleRate.
+	n := TargetSampleRate
+
+	plain, err := Spectrogram(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (n-FrameSize)/HopSize + 1; len(plain) != want {
+		t.Errorf("expected %d complete frames, got %d", want, len(plain))
+	}
+	for _, padding := range []dsp.Padding{dsp.PadCentre, dsp.PadReflect} {
+		padded, err := Config{Padding: padding}.Spectrogram(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (n + HopSize - 1) / HopSize; len(padded) != want {
+			t.Errorf("padding %d: expected %d frames, got %d", padding, want, len(padded))
+		}
+	}
+
+	if _, err := (Config{Padding: dsp.Padding(7)}).Spectrogram(samples, 44100); err == nil {
+		t.Error("expected error for an unknown padding")
+	}
+}
+
+func TestConfig_BandScale(t *testing.T) {
+	// The linear edges are those of DetectPeaks.
+	edges, err := Config{}.peakBands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 85, 170, 255, 340, 425, 513}; !reflect.DeepEqual(edges, want) {
+		t.Errorf("expected linear edges %v, got %v", want, edges)
+	}
+
+	for _, scale := range []dsp.Scale{dsp.ScaleMel, dsp.ScaleBark, dsp.ScaleLog} {
+		edges, err := Config{BandScale: scale}.peakBands()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(edges) != NumBands+1 || edges[NumBands] != FrameSize/2+1 {
+			t.Fatalf("scale %d: expected %d edges up to Nyquist, got %v", scale, NumBands+1, edges)
+		}
+		for i := 1; i < len(edges); i++ {
+			if edges[i] <= edges[i-1] {
+				t.Errorf("scale %d: expected increasing edges, got %v", scale, edges)
+				break
+			}
+		}
+		// The first band ends well below the linear 85 bins (~915 Hz).
+		if edges[1] > 40 {
+			t.Errorf("scale %d: expected a narrow first band, got %v", scale, edges)
+		}
+	}
+
+	// Notes across the musical range fall into separate log-spaced bands.
+	samples := make([]int16, 44100)
+	for i := range samples {
+		x := float64(i) / 44100
+		samples[i] = int16(4000*math.Sin(2*math.Pi*220*x) + 4000*math.Sin(2*math.Pi*440*x) + 4000*math.Sin(2*math.Pi*880*x))
+	}
+	countNotes := func(c Config) int {
+		peaks, err := c.ExtractPeaks(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[int]bool{}
+		for _, p := range peaks {
+			freq := float64(p.FreqBin) * TargetSampleRate / FrameSize
+			for _, note := range []float64{220, 440, 880} {
+				if math.Abs(freq-note) < 20 {
+					found[int(note)] = true
+				}
+			}
+		}
+		return len(found)
+	}
+	if got := countNotes(Config{}); got != 1 {
+		t.Errorf("expected linear bands to find 1 of 3 notes, got %d", got)
+	}
+	if got := countNotes(Config{BandScale: dsp.ScaleLog}); got != 3 {
+		t.Errorf("expected log bands to find 3 of 3 notes, got %d", got)
+	}
+
+	if _, err := (Config{BandScale: dsp.Scale(9)}).ExtractPeaks(samples, 44100); err == nil {
+		t.Error("expected error for an unknown scale")
+	}
+}
+
+func TestRefinePeaks(t *testing.T) {
+	binHz := float64(TargetSampleRate) / FrameSize
+	// Strongest peak of the first band for a tone at each offset from bin 40.
+	peakAt := func(c Config, offset float64) Peak {
+		freq := (40 + offset) * binHz
+		samples := make([]int16, 44100)
+		for i := range samples {
+			samples[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/44100))
+		}
+		peaks, err := c.ExtractPeaks(samples, 44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return peaks[len(peaks)/2/NumBands*NumBands]
+	}
+
+	for _, tc := range []struct {
+		interp       Interpolation
+		maxFreqError float64 // Hz
+		maxMagDB     float64 // Magnitude spread across offsets.
+	}{
+		{InterpolateNone, binHz / 2, 2},
+		{InterpolateParabolic, 1, 1},
+		{InterpolateQuadraticLog, 0.25, 0.5},
+	} {
+		c := Config{Interpolation: tc.interp}
+		var worstFreq, minMag, maxMag float64
+		minMag = math.Inf(1)
+		for _, offset := range []float64{0, 0.1, 0.25, 0.4, 0.5, 0.6, 0.75, 0.9} {
+			p := peakAt(c, offset)
+			worstFreq = max(worstFreq, math.Abs(p.Freq-(40+offset)*binHz))
+			minMag, maxMag = min(minMag, p.Magnitude), max(maxMag, p.Magnitude)
+		}
+		spread := 20 * math.Log10(maxMag/minMag)
+		if worstFreq > tc.maxFreqError {
+			t.Errorf("interpolation %d: expected a frequency error under %.2f Hz, got %.3f Hz", tc.interp, tc.maxFreqError, worstFreq)
+		}
+		if spread > tc.maxMagDB {
+			t.Errorf("interpolation %d: expected magnitudes within %.2f dB, got %.3f dB", tc.interp, tc.maxMagDB, spread)
+		}
+	}
+}
+
+func TestQuantizedLandmarks(t *testing.T) {
+	// A tone wandering across the boundary between bins 92 and 93.
+	first := []Peak{{FrameIndex: 0, FreqBin: 92, Freq: 995}, {FrameIndex: 3, FreqBin: 40, Freq: 430}}
+	second := []Peak{{FrameIndex: 0, FreqBin: 93, Freq: 1001}, {FrameIndex: 3, FreqBin: 40, Freq: 431}}
+
+	if Landmarks(first, 5)[0].Hash == Landmarks(second, 5)[0].Hash {
+		t.Error("expected bin hashes to differ")
+	}
+	a, b := QuantizedLandmarks(first, 5, 43)[0], QuantizedLandmarks(second, 5, 43)[0]
+	if a.Hash != b.Hash {
+		t.Errorf("expected equal hashes with 43 Hz steps, got %08x and %08x", a.Hash, b.Hash)
+	}
+	if want := uint32(23)<<23 | uint32(10)<<14 | 3; a.Hash != want {
+		t.Errorf("expected hash %08x, got %08x", want, a.Hash)
+	}
+
+	if !reflect.DeepEqual(QuantizedLandmarks(first, 5, 0), Landmarks(first, 5)) {
+		t.Error("expected a zero step to hash the bins")
+	}
+}
+
+func TestConfig_Gate(t *testing.T) {
+	// One second each of room noise, music, digital silence and music.
+	rng := rand.New(rand.NewSource(3))
+	samples := make([]int16, 4*44100)
+	for i := range samples {
+		x := float64(i) / 44100
+		switch i / 44100 {
+		case 0:
+			samples[i] = int16(rng.NormFloat64() * 30)
+		case 1, 3:
+			samples[i] = int16(6000*math.Sin(2*math.Pi*440*x) + 4000*math.Sin(2*math.Pi*1250*x) + rng.NormFloat64()*30)
+		}
+	}
+
+	result, err := Config{Gate: true}.Analyze(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NoiseFloor > -55 || result.NoiseFloor < -80 {
+		t.Errorf("expected a noise floor around -61 dBFS, got %f", result.NoiseFloor)
+	}
+	if len(result.Silence) != 2 {
+		t.Fatalf("expected 2 silent regions, got %v", result.Silence)
+	}
+	for i, want := range [][2]float64{{0, 1}, {2, 3}} {
+		start, end := result.Silence[i].Seconds()
+		if math.Abs(start-want[0]) > 0.1 || math.Abs(end-want[1]) > 0.1 {
+			t.Errorf("region %d: expected %v s, got %.2f-%.2f s", i, want, start, end)
+		}
+	}
+	for _, p := range result.Peaks {
+		for _, r := range result.Silence {
+			if p.FrameIndex >= r.Start && p.FrameIndex < r.End {
+				t.Fatalf("expected no peaks in silent frames, got %+v", p)
+			}
+		}
+	}
+	ungated, err := Config{}.Analyze(samples, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Peaks) >= len(ungated.Peaks)*3/4 {
+		t.Errorf("expected about half the peaks to be gated, got %d of %d", len(result.Peaks), len(ungated.Peaks))
+	}
+	if ungated.Silence != nil {
+		t.Error("expected no silent regions without the gate")
+	}
+
+	// Steady music has no pauses to gate.
+	music := slices.Clone(samples[44100 : 2*44100])
+	result, err = Config{Gate: true}.Analyze(music, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Silence) != 0 {
+		t.Errorf("expected no silence in steady music, got %v", result.Silence)
+	}
+}
+
+func TestConfig_Loudness(t *testing.T) {
+	// The same notes recorded 18 dB apart.
+	record := func(amplitude float64) []int16 {
+		samples := make([]int16, 3*44100)
+		for i := range samples {
+			freq := []float64{440, 660, 550}[i/44100]
+			samples[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/44100))
+		}
+		return samples
+	}
+	quiet, loud := record(2000), record(16000)
+
+	c := Config{TargetLoudness: -23}
+	a, err := c.Analyze(quiet, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Analyze(loud, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A sine of amplitude 2000/32768 is -27.3 dBFS RMS, and K-weighting
+	// takes off about half a dB between 440 and 660 Hz.
+	if math.Abs(a.Loudness-(-27.9)) > 0.3 || math.Abs(b.Loudness-a.Loudness-18.06) > 0.1 {
+		t.Errorf("expected -27.9 and -9.8 LUFS, got %.2f and %.2f", a.Loudness, b.Loudness)
+	}
+	// The notes, the strongest peak of every frame, come out equally strong.
+	strongest := func(peaks []Peak) map[int]Peak {
+		byFrame := map[int]Peak{}
+		for _, p := range peaks {
+			if p.Magnitude > byFrame[p.FrameIndex].Magnitude {
+				byFrame[p.FrameIndex] = p
+			}
+		}
+		return byFrame
+	}
+	notesA, notesB := strongest(a.Peaks), strongest(b.Peaks)
+	for frame, p := range notesA {
+		q := notesB[frame]
+		if p.FreqBin != q.FreqBin || math.Abs(p.Magnitude-q.Magnitude) > 1e-3*q.Magnitude {
+			t.Fatalf("frame %d: expected normalised notes to match, got %+v and %+v", frame, p, q)
+		}
+	}
+
+	// A gain does not move the peaks, so the hashes are unchanged.
+	want, err := Fingerprint(quiet, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Fingerprint(quiet, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("expected normalisation to keep the hashes")
+	}
+
+	measured, err := Config{MeasureLoudness: true}.Analyze(quiet, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if measured.Loudness != a.Loudness {
+		t.Errorf("expected MeasureLoudness to report %.2f LUFS, got %.2f", a.Loudness, measured.Loudness)
+	}
+	if unmeasured, _ := (Config{}).Analyze(quiet, 44100); unmeasured.Loudness != 0 {
+		t.Errorf("expected no loudness without measuring, got %f", unmeasured.Loudness)
+	}
+}
+
+func TestConfig_Float32(t *testing.T) {
+	// Random chords over noise at common and awkward rates, a melody at
+	// the target rate, and the gate's mix of noise, music and silence.
+	chords := func(seed int64, sampleRate int, amplitude float64) []int16 {
+		rng := rand.New(rand.NewSource(seed))
+		samples := make([]int16, 6*sampleRate)
+		freqs := [3]float64{}
+		for i := range samples {
+			if i%(sampleRate/4) == 0 {
+				for k := range freqs {
+					freqs[k] = 200 + rng.Float64()*3000
+				}
+			}
+			v := 0.0
+			for _, f := range freqs {
+				v += math.Sin(2 * math.Pi * f * float64(i) / float64(sampleRate))
+			}
+			samples[i] = int16(amplitude * (v + rng.NormFloat64()/20))
+		}
+		return samples
+	}
+	rng := rand.New(rand.NewSource(3))
+	mixed := make([]int16, 4*44100)
+	for i := range mixed {
+		x := float64(i) / 44100
+		switch i / 44100 {
+		case 0:
+			mixed[i] = int16(rng.NormFloat64() * 30)
+		case 1, 3:
+			mixed[i] = int16(6000*math.Sin(2*math.Pi*440*x) + 4000*math.Sin(2*math.Pi*1250*x) + rng.NormFloat64()*30)
+		}
+	}
+	corpus := []struct {
+		samples    []int16
+		sampleRate int
+	}{
+		{chords(1, 44100, 6000), 44100},
+		{chords(2, 48000, 6000), 48000},
+		{chords(3, 44101, 30), 44101},
+		{chords(4, 96000, 2), 96000},
+		{melody([]int{60, 64, 67, 72, 71, 67, 64, 62}, 0.5), TargetSampleRate},
+		{mixed, 44100},
+	}
+	configs := []Config{
+		{},
+		{Window: dsp.Window{Type: dsp.WindowBlackmanHarris}, Padding: dsp.PadReflect},
+		{BandScale: dsp.ScaleLog, Interpolation: InterpolateQuadraticLog, HashFreqStep: 12, MeasureLoudness: true},
+		// The filters smear rounding noise into digital silence, where
+		// the pipelines pick different bins, so it is gated.
+		{Gate: true, TargetLoudness: -23, BandLow: 300, PreEmphasis: 0.97},
+	}
+
+	// The magnitudes differ by float32 rounding, about 1e-7 of the
+	// loudest bin of the frame. Where two bins of a band are that close
+	// the other one may win, which changes the hashes of that peak.
+	peaks, flips, hashes, changed := 0, 0, 0, 0
+	for i, in := range corpus {
+		for _, c := range configs {
+			want, err := c.Analyze(in.samples, in.sampleRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c32 := c
+			c32.Float32 = true
+			got, err := c32.Analyze(in.samples, in.sampleRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Peaks) != len(want.Peaks) {
+				t.Fatalf("input %d, %+v: expected %d peaks, got %d", i, c, len(want.Peaks), len(got.Peaks))
+			}
+			var spectrogram [][]float64
+			peaks += len(want.Peaks)
+			for j, p := range want.Peaks {
+				q := got.Peaks[j]
+				if p.FrameIndex != q.FrameIndex {
+					t.Fatalf("input %d, %+v: expected peak %+v, got %+v", i, c, p, q)
+				}
+				if p.FreqBin != q.FreqBin {
+					if spectrogram == nil {
+						if spectrogram, err = c.Spectrogram(in.samples, in.sampleRate); err != nil {
+							t.Fatal(err)
+						}
+					}
+					// Rounding errors are relative to the loudest bin, and
+					// frames of digital silence hold nothing else.
+					frame := spectrogram[p.FrameIndex]
+					if a, b := frame[p.FreqBin], frame[q.FreqBin]; math.Abs(a-b) > 1e-6*max(slices.Max(frame), 1) {
+						t.Fatalf("input %d, %+v: expected peak %+v, got %+v, %.3g apart", i, c, p, q, (a-b)/slices.Max(frame))
+					}
+					flips++
+					continue
+				}
+				if math.Abs(p.Magnitude-q.Magnitude) > 1e-4*p.Magnitude+1e-9 || p.Magnitude > 1e-6 && math.Abs(p.Freq-q.Freq) > 0.01 {
+					t.Fatalf("input %d, %+v: expected peak %+v, got %+v", i, c, p, q)
+				}
+			}
+			wantLandmarks, gotLandmarks := c.Landmarks(want.Peaks), c.Landmarks(got.Peaks)
+			for j, l := range wantLandmarks {
+				hashes++
+				if gotLandmarks[j].Hash != l.Hash {
+					changed++
+				}
+			}
+			if !reflect.DeepEqual(got.Silence, want.Silence) || math.Abs(got.NoiseFloor-want.NoiseFloor) > 1e-3 || got.Loudness != want.Loudness {
+				t.Errorf("input %d, %+v: expected silence %v, floor %.2f, loudness %.2f, got %v, %.2f, %.2f",
+					i, c, want.Silence, want.NoiseFloor, want.Loudness, got.Silence, got.NoiseFloor, got.Loudness)
+			}
+		}
+	}
+	// On this corpus one peak in about 15000 flips, changing about one
+	// hash in 10000.
+	if flips*1000 > peaks || changed*1000 > hashes {
+		t.Errorf("expected at most 0.1%% of peaks and hashes to differ, got %d of %d peaks and %d of %d hashes",
+			flips, peaks, changed, hashes)
+	}
+
+	spectrogram, err := Spectrogram(mixed, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat, err := Config{}.Spectrogram32(mixed, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flat.Frames != len(spectrogram) || flat.Bins != FrameSize/2+1 {
+		t.Fatalf("expected %d frames of %d bins, got %d of %d", len(spectrogram), FrameSize/2+1, flat.Frames, flat.Bins)
+	}
+	for i, frame := range flat.Float64() {
+		if !almostEqualSlices(frame, spectrogram[i], 1e-5) {
+			t.Fatalf("frame %d: expected the float32 spectrogram to match", i)
+		}
+	}
+	if _, err := (Config{Float32: true}).Fingerprint(make([]int16, 100), 8000); err == nil {
+		t.Error("expected error for a sample rate below the target rate")
+	}
+}
@@ -0,0 +1,109 @@
+package fingerprint
+
+import (
+	"errors"
+	"fingerprint/dsp"
+)
+
+// spectrogramPool recycles the spectrogram buffers of Analyze with
+// Config.Float32.
+var spectrogramPool dsp.Float32Pool
+
+// DetectPeaks32 is DetectPeaksInBands on a float32 spectrogram.
+func DetectPeaks32(spectrogram *dsp.Spectrogram32, edges []int) []Peak {
+	return detectPeaks(spectrogram.Frames, spectrogram.Frame, edges)
+}
+
+// RefinePeaks32 is RefinePeaks on a float32 spectrogram.
+func RefinePeaks32(spectrogram *dsp.Spectrogram32, peaks []Peak, interp Interpolation, binHz float64) []Peak {
+	return refinePeaks(spectrogram.Frame, peaks, interp, binHz)
+}
+
+// Spectrogram32 returns the magnitude spectrum of every frame of the audio
+// from the float32 pipeline, whatever Config.Float32 is.
+func (c Config) Spectrogram32(samples []int16, sampleRate int) (*dsp.Spectrogram32, error) {
+	signal, _, err := c.prepare32(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return c.spectrogram32(signal, nil)
+}
+
+// analyze32 is Analyze in float32. The spectrogram goes back to
+// spectrogramPool once the peaks are refined.
+func (c Config) analyze32(samples []int16, sampleRate int) (*Result, error) {
+	signal, loudness, err := c.prepare32(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	spectrogram, err := c.spectrogram32(signal, &spectrogramPool)
+	if err != nil {
+		return nil, err
+	}
+	defer spectrogramPool.Put(spectrogram.Data)
+
+	edges, err := c.peakBands()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Loudness: loudness}
+	if c.KeepSpectrogram {
+		result.Spectrogram = spectrogram.Float64()
+	}
+	peaks := DetectPeaks32(spectrogram, edges)
+	if c.Gate {
+		levels, err := dsp.FrameRMS32(signal, FrameSize, HopSize, c.Padding)
+		if err != nil {
+			return nil, err
+		}
+		peaks = result.gate(peaks, levels)
+	}
+	result.Peaks = RefinePeaks32(spectrogram, peaks, c.Interpolation, float64(TargetSampleRate)/FrameSize)
+	return result, nil
+}
+
+// prepare32 is prepare in float32. The gain and filters are only written
+// for float64, so with any of them the downsampled signal makes a round
+// trip through float64.
+func (c Config) prepare32(samples []int16, sampleRate int) ([]float32, float64, error) {
+	downsampled, err := downsample32(samples, sampleRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.TargetLoudness == 0 && c.BandLow <= 0 && c.BandHigh <= 0 && c.PreEmphasis == 0 {
+		loudness := 0.0
+		if c.MeasureLoudness {
+			loudness = measureLoudness(samples, sampleRate)
+		}
+		return downsampled, loudness, nil
+	}
+
+	signal := make([]float64, len(downsampled))
+	for i, x := range downsampled {
+		signal[i] = float64(x)
+	}
+	signal, loudness, err := c.condition(signal, samples, sampleRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, x := range signal {
+		downsampled[i] = float32(x)
+	}
+	return downsampled, loudness, nil
+}
+
+// spectrogram32 is spectrogram in float32, with the storage taken from
+// pool.
+func (c Config) spectrogram32(signal []float32, pool *dsp.Float32Pool) (*dsp.Spectrogram32, error) {
+	spec := dsp.STFTSpec{FrameSize: FrameSize, HopSize: HopSize, Window: c.Window, Padding: c.Padding}
+	return dsp.MagnitudeSpectrogram32(signal, spec, pool)
+}
+
+// downsample32 resamples 16-bit samples to TargetSampleRate in float32.
+func downsample32(samples []int16, sampleRate int) ([]float32, error) {
+	if sampleRate < TargetSampleRate {
+		return nil, errors.New("sample rate is lower than target sample rate")
+	}
+	resampler := dsp.NewMultiStageResampler(sampleRate, TargetSampleRate, FilterTaps)
+	return resampler.ResampleInt16(samples), nil
+}
@@ -0,0 +1,68 @@
+package fingerprint
+
+import (
+	"fingerprint/dsp"
+	"math"
+	"slices"
+)
+
+// Region is a run of frames from Start up to, but not including, End.
+type Region struct {
+	Start, End int
+}
+
+// Seconds returns the start and end of the region in seconds.
+func (r Region) Seconds() (start, end float64) {
+	return float64(r.Start*HopSize) / TargetSampleRate, float64(r.End*HopSize) / TargetSampleRate
+}
+
+// gate marks the silent frames from their RMS levels and returns the noise
+// floor in dBFS. The noise floor is the GatePercentile of the frame levels
+// above GateMinLevel, so it adapts to the recording. A frame is silent when its level is both
+// under GateMargin above the floor and more than GateRange below the
+// GateLoudLevel percentile, so steady music without pauses is not gated.
+// Below GateMinLevel a frame is always silent.
+func gate(rms []float64) (silent []bool, noiseFloor float64) {
+	levels := make([]float64, len(rms))
+	for i, a := range rms {
+		levels[i] = dsp.AmplitudeToDB(a)
+	}
+	// Digital silence says nothing about the noise of the recording.
+	sorted := slices.DeleteFunc(slices.Clone(levels), func(level float64) bool { return level < GateMinLevel })
+	slices.Sort(sorted)
+	noiseFloor = percentile(sorted, GatePercentile)
+	loud := percentile(sorted, GateLoudLevel)
+	threshold := max(min(noiseFloor+GateMargin, loud-GateRange), GateMinLevel)
+
+	silent = make([]bool, len(levels))
+	for i, level := range levels {
+		silent[i] = level < threshold
+	}
+	return silent, noiseFloor
+}
+
+// percentile returns the p-th percentile of sorted values by the nearest
+// rank. It is minus infinity for no values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.Inf(-1)
+	}
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// silentRegions merges consecutive silent frames into regions.
+func silentRegions(silent []bool) []Region {
+	var regions []Region
+	for i := 0; i < len(silent); i++ {
+		if !silent[i] {
+			continue
+		}
+		start := i
+		for i < len(silent) && silent[i] {
+			i++
+		}
+		regions = append(regions, Region{Start: start, End: i})
+	}
+	return regions
+}
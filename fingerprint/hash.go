@@ -1,12 +1,47 @@
 package fingerprint
 
+import "math"
+
+// Landmark is a pair of peaks together with the hash that encodes it.
+type Landmark struct {
+	Anchor Peak
+	Target Peak
+	Hash   uint32
+}
+
 // HashFingerprint creates 32-bit hashes from pairs of audio peaks.
 // Each hash combines:
 // - 9 bits: anchor frequency
 // - 9 bits: target frequency
 // - 14 bits: time delta between peaks
 func HashFingerprint(peaks []Peak, targetZone int) []uint32 {
-	var hashes []uint32
+	landmarks := Landmarks(peaks, targetZone)
+	hashes := make([]uint32, len(landmarks))
+	for i, l := range landmarks {
+		hashes[i] = l.Hash
+	}
+	return hashes
+}
+
+// Landmarks pairs every peak with the later peaks in its target zone and
+// returns the pairs in the same order as the hashes of HashFingerprint.
+func Landmarks(peaks []Peak, targetZone int) []Landmark {
+	return QuantizedLandmarks(peaks, targetZone, 0)
+}
+
+// QuantizedLandmarks is Landmarks with the peak frequencies in the hash
+// quantised to steps of freqStep Hz, using the refined Freq of each peak
+// instead of its bin. Steps wider than a bin keep a peak that wanders
+// between neighbouring bins in one step, so the hash repeats. A freqStep
+// of zero hashes FreqBin like Landmarks.
+func QuantizedLandmarks(peaks []Peak, targetZone int, freqStep float64) []Landmark {
+	quantize := func(p Peak) uint32 {
+		if freqStep > 0 {
+			return uint32(math.Round(p.Freq / freqStep))
+		}
+		return uint32(p.FreqBin)
+	}
+	var landmarks []Landmark
 	for i, anchor := range peaks {
 		for j := i + 1; j < len(peaks); j++ {
 			target := peaks[j]
@@ -17,8 +52,8 @@ func HashFingerprint(peaks []Peak, targetZone int) []uint32 {
 			if dt > targetZone {
 				break
 			}
-			f1 := uint32(anchor.FreqBin)
-			f2 := uint32(target.FreqBin)
+			f1 := quantize(anchor)
+			f2 := quantize(target)
 			dtU := uint32(dt)
 
 			if f1 > 0x1FF {
@@ -31,8 +66,8 @@ func HashFingerprint(peaks []Peak, targetZone int) []uint32 {
 				dtU = 0x3FFF
 			}
 			hash := (f1 << 23) | (f2 << 14) | dtU
-			hashes = append(hashes, hash)
+			landmarks = append(landmarks, Landmark{Anchor: anchor, Target: target, Hash: hash})
 		}
 	}
-	return hashes
+	return landmarks
 }
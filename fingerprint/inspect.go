@@ -0,0 +1,127 @@
+package fingerprint
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// InspectDynamicRange is the range in dB below the loudest bin that is
+// mapped onto the heatmap colours; quieter bins are drawn black.
+const InspectDynamicRange = 80.0
+
+var (
+	peakColor = color.RGBA{R: 0, G: 255, B: 255, A: 255}
+	pairColor = color.RGBA{R: 0, G: 200, B: 0, A: 255}
+)
+
+// RenderConstellation writes the spectrogram as a PNG heatmap, one pixel per
+// frame and frequency bin with low frequencies at the bottom. Peaks are
+// marked with crosses and, when landmarks is not nil, each landmark is drawn
+// as a line from its anchor to its target peak.
+func RenderConstellation(w io.Writer, spectrogram [][]float64, peaks []Peak, landmarks []Landmark) error {
+	img := renderSpectrogram(spectrogram)
+	height := img.Bounds().Dy()
+
+	for _, l := range landmarks {
+		drawLine(img, l.Anchor.FrameIndex, height-1-l.Anchor.FreqBin,
+			l.Target.FrameIndex, height-1-l.Target.FreqBin, pairColor)
+	}
+	for _, p := range peaks {
+		x, y := p.FrameIndex, height-1-p.FreqBin
+		for d := -2; d <= 2; d++ {
+			setPixel(img, x+d, y, peakColor)
+			setPixel(img, x, y+d, peakColor)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// renderSpectrogram maps log magnitudes onto a black-blue-red-yellow-white scale.
+func renderSpectrogram(spectrogram [][]float64) *image.RGBA {
+	height := 1
+	maxMag := 0.0
+	for _, frame := range spectrogram {
+		height = max(height, len(frame))
+		for _, v := range frame {
+			maxMag = max(maxMag, v)
+		}
+	}
+	width := max(len(spectrogram), 1)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			level := 0.0
+			if x < len(spectrogram) && y < len(spectrogram[x]) && maxMag > 0 {
+				db := 20 * math.Log10(spectrogram[x][y]/maxMag)
+				level = math.Max(0, 1+db/InspectDynamicRange)
+			}
+			img.SetRGBA(x, height-1-y, heatColor(level))
+		}
+	}
+	return img
+}
+
+// heatColor interpolates the heatmap colour for a level between 0 and 1.
+func heatColor(level float64) color.RGBA {
+	stops := [...]color.RGBA{
+		{0, 0, 0, 255},
+		{0, 0, 160, 255},
+		{200, 0, 0, 255},
+		{255, 220, 0, 255},
+		{255, 255, 255, 255},
+	}
+	pos := math.Min(math.Max(level, 0), 1) * float64(len(stops)-1)
+	i := min(int(pos), len(stops)-2)
+	t := pos - float64(i)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float64(a) + t*(float64(b)-float64(a)))
+	}
+	a, b := stops[i], stops[i+1]
+	return color.RGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: 255}
+}
+
+// drawLine draws a line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		setPixel(img, x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func setPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	if image.Pt(x, y).In(img.Bounds()) {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
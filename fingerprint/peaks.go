@@ -1,25 +1,65 @@
 package fingerprint
 
+import "math"
+
 type Peak struct {
 	FrameIndex int
 	FreqBin    int
 	Magnitude  float64
+	Freq       float64 // Frequency in Hz, set by RefinePeaks.
 }
 
+// Interpolation selects how RefinePeaks estimates the frequency and
+// magnitude of a peak between FFT bins.
+type Interpolation int
+
+const (
+	// InterpolateNone places the peak at the centre of its bin.
+	InterpolateNone Interpolation = iota
+	// InterpolateParabolic fits a parabola through the magnitudes of the
+	// peak bin and its two neighbours.
+	InterpolateParabolic
+	// InterpolateQuadraticLog fits the parabola to log magnitudes, which
+	// is exact for a Gaussian main lobe and close to it for the Hamming
+	// window.
+	InterpolateQuadraticLog
+)
+
 // DetectPeaks finds the strongest frequency peaks in each band of the spectrogram
 func DetectPeaks(spectrogram [][]float64, numBands int) []Peak {
+	if len(spectrogram) == 0 {
+		return []Peak{}
+	}
+	return DetectPeaksInBands(spectrogram, linearBandEdges(len(spectrogram[0]), numBands))
+}
+
+// linearBandEdges splits numBins into numBands equal bands, the last one
+// taking the remainder.
+func linearBandEdges(numBins, numBands int) []int {
+	bandSize := numBins / numBands
+	edges := make([]int, numBands+1)
+	for band := range numBands {
+		edges[band] = band * bandSize
+	}
+	edges[numBands] = numBins
+	return edges
+}
+
+// DetectPeaksInBands finds the strongest peak of each frame between every
+// pair of consecutive bin edges, so bands can be spaced on any scale.
+func DetectPeaksInBands(spectrogram [][]float64, edges []int) []Peak {
+	return detectPeaks(len(spectrogram), func(t int) []float64 { return spectrogram[t] }, edges)
+}
+
+// detectPeaks is DetectPeaksInBands over frames of either precision.
+func detectPeaks[F float32 | float64](numFrames int, frameAt func(int) []F, edges []int) []Peak {
 	var peaks []Peak
-	for i, frame := range spectrogram {
-		numBins := len(frame)
-		bandSize := numBins / numBands
-
-		for band := 0; band < numBands; band++ {
-			start := band * bandSize
-			end := start + bandSize
-			if band == numBands-1 {
-				end = numBins
-			}
-			maxVal := -1.0
+	for i := range numFrames {
+		frame := frameAt(i)
+		for band := 0; band+1 < len(edges); band++ {
+			start := edges[band]
+			end := min(edges[band+1], len(frame))
+			var maxVal F = -1
 			maxBin := -1
 			for j := start; j < end; j++ {
 				if frame[j] > maxVal {
@@ -31,10 +71,57 @@ func DetectPeaks(spectrogram [][]float64, numBands int) []Peak {
 				peaks = append(peaks, Peak{
 					FrameIndex: i,
 					FreqBin:    maxBin,
-					Magnitude:  maxVal,
+					Magnitude:  float64(maxVal),
 				})
 			}
 		}
 	}
 	return peaks
 }
+
+// RefinePeaks returns the peaks with Freq set in Hz, given the width of a
+// bin, and with the frequency and magnitude interpolated between bins of
+// the spectrogram they were found in. FreqBin stays the nearest bin.
+// Peaks at the edges of the spectrum or next to a silent bin are not
+// interpolated.
+func RefinePeaks(spectrogram [][]float64, peaks []Peak, interp Interpolation, binHz float64) []Peak {
+	return refinePeaks(func(t int) []float64 { return spectrogram[t] }, peaks, interp, binHz)
+}
+
+// refinePeaks is RefinePeaks over frames of either precision. The
+// interpolation is in float64.
+func refinePeaks[F float32 | float64](frameAt func(int) []F, peaks []Peak, interp Interpolation, binHz float64) []Peak {
+	refined := make([]Peak, len(peaks))
+	for i, p := range peaks {
+		offset := 0.0
+		frame := frameAt(p.FrameIndex)
+		k := p.FreqBin
+		if interp != InterpolateNone && k > 0 && k+1 < len(frame) {
+			a, b, c := float64(frame[k-1]), float64(frame[k]), float64(frame[k+1])
+			if interp == InterpolateQuadraticLog {
+				if a > 0 && b > 0 && c > 0 {
+					offset, b = parabolicPeak(math.Log(a), math.Log(b), math.Log(c))
+					b = math.Exp(b)
+				}
+			} else {
+				offset, b = parabolicPeak(a, b, c)
+			}
+			p.Magnitude = b
+		}
+		p.Freq = (float64(k) + offset) * binHz
+		refined[i] = p
+	}
+	return refined
+}
+
+// parabolicPeak returns the offset, within half a bin, and height of the
+// vertex of the parabola through (-1, a), (0, b) and (1, c).
+func parabolicPeak(a, b, c float64) (offset, height float64) {
+	denom := a - 2*b + c
+	if denom >= 0 {
+		// Not a maximum: b is no larger than both neighbours.
+		return 0, b
+	}
+	offset = max(-0.5, min(0.5, 0.5*(a-c)/denom))
+	return offset, b - 0.25*(a-c)*offset
+}
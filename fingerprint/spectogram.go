@@ -1,27 +1,47 @@
 package fingerprint
 
 import (
-	"fingerprint/dsp"
+	"math"
+	"runtime"
 	"sync"
+
+	"gonum.org/v1/gonum/dsp/fourier"
 )
 
+// computeSpectrogram windows every frame in place and returns its magnitude
+// spectrum. The frames are split between one worker per CPU, each with its
+// own FFT and coefficient buffer.
 func computeSpectrogram(frames [][]float64, window []float64) [][]float64 {
 	numFrames := len(frames)
 	spectrogram := make([][]float64, numFrames)
+	workers := max(min(runtime.GOMAXPROCS(0), numFrames), 1)
 	var wg sync.WaitGroup
 
-	for i, frame := range frames {
+	for w := range workers {
 		wg.Add(1)
-		go func(i int, frame []float64) {
+		go func(first, last int) {
 			defer wg.Done()
 
-			for j := range frame {
-				frame[j] *= window[j]
-			}
+			var fft *fourier.FFT
+			var coeffs []complex128
+			for i := first; i < last; i++ {
+				frame := frames[i]
+				if fft == nil || fft.Len() != len(frame) {
+					fft = fourier.NewFFT(len(frame))
+					coeffs = make([]complex128, len(frame)/2+1)
+				}
+				for j := range frame {
+					frame[j] *= window[j]
+				}
 
-			magnitudes := dsp.ComputeFFT(frame)
-			spectrogram[i] = magnitudes
-		}(i, frame)
+				fft.Coefficients(coeffs, frame)
+				magnitudes := make([]float64, len(coeffs))
+				for k, c := range coeffs {
+					magnitudes[k] = math.Hypot(real(c), imag(c))
+				}
+				spectrogram[i] = magnitudes
+			}
+		}(w*numFrames/workers, (w+1)*numFrames/workers)
 	}
 	wg.Wait()
 	return spectrogram
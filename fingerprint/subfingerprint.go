@@ -0,0 +1,135 @@
+package fingerprint
+
+import (
+	"fingerprint/dsp"
+	"math"
+	"math/bits"
+)
+
+const (
+	SubFingerprintFrameSize    = 4096   // ~0.37 s at TargetSampleRate.
+	SubFingerprintHopSize      = 128    // ~11.6 ms at TargetSampleRate.
+	SubFingerprintBands        = 33     // Log-spaced bands, giving 32 bits per frame.
+	SubFingerprintMinFreq      = 300.0  // Lowest band edge in Hz.
+	SubFingerprintMaxFreq      = 2000.0 // Highest band edge in Hz.
+	SubFingerprintBERThreshold = 0.35   // Maximum bit error rate for a match.
+)
+
+// SubFingerprint generates Haitsma–Kalker style sub-fingerprints from audio samples.
+// Every frame yields one 32-bit value whose bits are the signs of the energy
+// differences between adjacent bands, taken relative to the previous frame.
+// Unlike landmark hashes no peaks are involved, so sub-fingerprints survive
+// heavy compression; they are compared with BitErrorRate instead of exact lookup.
+func SubFingerprint(samples []int16, sampleRate int) ([]uint32, error) {
+	downsampled, err := downsample(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Frames overlap by 97%, so they are streamed and only their band
+	// energies are kept: an hour would otherwise hold 310000 spectra.
+	edges := logBandEdges(SubFingerprintMinFreq, SubFingerprintMaxFreq, SubFingerprintBands,
+		TargetSampleRate, SubFingerprintFrameSize)
+	spec := dsp.STFTSpec{FrameSize: SubFingerprintFrameSize, HopSize: SubFingerprintHopSize}
+	var energies [][]float64
+	if n := len(downsampled); n >= SubFingerprintFrameSize {
+		energies = make([][]float64, (n-SubFingerprintFrameSize)/SubFingerprintHopSize+1)
+	}
+	err = dsp.MagnitudeFrames(downsampled, spec, func(t int, magnitudes []float64) {
+		energies[t] = bandEnergies(magnitudes, edges)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return energyFingerprints(energies), nil
+}
+
+// logBandEdges returns numBands+1 FFT bin indices spaced logarithmically
+// between minFreq and maxFreq.
+func logBandEdges(minFreq, maxFreq float64, numBands, sampleRate, frameSize int) []int {
+	edges := make([]int, numBands+1)
+	ratio := math.Pow(maxFreq/minFreq, 1/float64(numBands))
+	for i := range edges {
+		freq := minFreq * math.Pow(ratio, float64(i))
+		edges[i] = int(math.Round(freq * float64(frameSize) / float64(sampleRate)))
+	}
+	return edges
+}
+
+// subFingerprints derives one 32-bit sub-fingerprint per frame from the band
+// energies of the spectrogram. Bit m of frame n is set when
+// E(n,m) - E(n,m+1) - (E(n-1,m) - E(n-1,m+1)) > 0.
+func subFingerprints(spectrogram [][]float64, edges []int) []uint32 {
+	energies := make([][]float64, len(spectrogram))
+	for i, frame := range spectrogram {
+		energies[i] = bandEnergies(frame, edges)
+	}
+	return energyFingerprints(energies)
+}
+
+// energyFingerprints is subFingerprints on the band energies of every frame.
+func energyFingerprints(energies [][]float64) []uint32 {
+	if len(energies) < 2 {
+		return []uint32{}
+	}
+	result := make([]uint32, 0, len(energies)-1)
+	for n := 1; n < len(energies); n++ {
+		prev, curr := energies[n-1], energies[n]
+		var sub uint32
+		for m := 0; m < len(curr)-1 && m < 32; m++ {
+			diff := curr[m] - curr[m+1] - (prev[m] - prev[m+1])
+			if diff > 0 {
+				sub |= 1 << (31 - m)
+			}
+		}
+		result = append(result, sub)
+	}
+	return result
+}
+
+// bandEnergies sums the squared magnitudes of each band.
+func bandEnergies(frame []float64, edges []int) []float64 {
+	energies := make([]float64, len(edges)-1)
+	for b := range energies {
+		end := edges[b+1]
+		if end <= edges[b] {
+			end = edges[b] + 1
+		}
+		for j := edges[b]; j < end && j < len(frame); j++ {
+			energies[b] += frame[j] * frame[j]
+		}
+	}
+	return energies
+}
+
+// BitErrorRate returns the fraction of differing bits between two equally
+// long blocks of sub-fingerprints. Extra values in the longer block are ignored.
+func BitErrorRate(a, b []uint32) float64 {
+	n := min(len(a), len(b))
+	if n == 0 {
+		return 1
+	}
+	errs := 0
+	for i := 0; i < n; i++ {
+		errs += bits.OnesCount32(a[i] ^ b[i])
+	}
+	return float64(errs) / float64(n*32)
+}
+
+// MatchSubFingerprints slides the query block over the reference and returns
+// the frame offset with the lowest bit error rate. It reports a match when
+// that rate is below SubFingerprintBERThreshold. An offset of -1 means the
+// query is empty or longer than the reference.
+func MatchSubFingerprints(query, reference []uint32) (offset int, ber float64, ok bool) {
+	if len(query) == 0 || len(query) > len(reference) {
+		return -1, 1, false
+	}
+	offset, ber = -1, 1.0
+	for i := 0; i+len(query) <= len(reference); i++ {
+		r := BitErrorRate(query, reference[i:i+len(query)])
+		if r < ber {
+			offset, ber = i, r
+		}
+	}
+	return offset, ber, ber < SubFingerprintBERThreshold
+}
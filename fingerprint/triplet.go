@@ -0,0 +1,65 @@
+package fingerprint
+
+import "math"
+
+// HashTriplets creates 32-bit hashes from triplets of audio peaks.
+// Instead of absolute frequencies and time deltas it encodes ratios,
+// which stay the same when the audio is played back faster or slower.
+// Each hash combines:
+// - 10 bits: log2 frequency ratio of the second peak to the anchor
+// - 10 bits: log2 frequency ratio of the third peak to the anchor
+// - 12 bits: ratio of the anchor→second and anchor→third time deltas
+//
+// Frequency ratios are quantised in 1/32 octave steps. For every anchor
+// only the first fanOut peaks in later frames within targetZone are
+// combined, which keeps the number of triplets linear in len(peaks).
+func HashTriplets(peaks []Peak, targetZone int, fanOut int) []uint32 {
+	hashes := []uint32{}
+	for i, anchor := range peaks {
+		if anchor.FreqBin <= 0 {
+			continue
+		}
+		var targets []Peak
+		for j := i + 1; j < len(peaks) && len(targets) < fanOut; j++ {
+			p := peaks[j]
+			dt := p.FrameIndex - anchor.FrameIndex
+			if dt <= 0 || p.FreqBin <= 0 {
+				continue
+			}
+			if dt > targetZone {
+				break
+			}
+			targets = append(targets, p)
+		}
+
+		for j, second := range targets {
+			for _, third := range targets[j+1:] {
+				if third.FrameIndex <= second.FrameIndex {
+					continue
+				}
+				r1 := quantizeFreqRatio(second.FreqBin, anchor.FreqBin)
+				r2 := quantizeFreqRatio(third.FreqBin, anchor.FreqBin)
+				dt1 := float64(second.FrameIndex - anchor.FrameIndex)
+				dt2 := float64(third.FrameIndex - anchor.FrameIndex)
+				tr := uint32(math.Round(dt1 / dt2 * 0xFFF))
+
+				hash := (r1 << 22) | (r2 << 12) | tr
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// quantizeFreqRatio maps log2(f/ref) to a 10-bit value in 1/32 octave steps,
+// centred on 512 and clipped to the available range.
+func quantizeFreqRatio(f, ref int) uint32 {
+	q := math.Round(math.Log2(float64(f)/float64(ref))*32) + 512
+	if q < 0 {
+		q = 0
+	}
+	if q > 0x3FF {
+		q = 0x3FF
+	}
+	return uint32(q)
+}
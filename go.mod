@@ -2,10 +2,12 @@ module fingerprint
 
 go 1.24.1
 
-require github.com/go-audio/wav v1.1.0
-
 require (
 	github.com/go-audio/audio v1.0.0 // indirect
-	github.com/go-audio/riff v1.0.0 // indirect
+	github.com/go-audio/wav v1.1.0
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/pion/opus v0.1.0
 	gonum.org/v1/gonum v0.15.1
 )
+
+require github.com/go-audio/riff v1.0.0 // indirect
@@ -0,0 +1,121 @@
+package index
+
+import (
+	"fingerprint/fingerprint"
+	"time"
+)
+
+const (
+	MinMatchScore = 10  // Minimum number of time-aligned hashes for a match.
+	MinMatchRatio = 2.0 // Best score must exceed the runner-up by this factor.
+)
+
+// Track holds the metadata stored with every indexed recording.
+type Track struct {
+	ID       int
+	Name     string
+	Start    time.Time         // Wall-clock time of the first sample, zero if unknown.
+	Metadata map[string]string // Free-form metadata such as the originator of a broadcast WAV file.
+}
+
+// Match is the result of a query against the index.
+type Match struct {
+	Track  Track
+	Offset int // Frame in the track where the query starts.
+	Score  int // Number of hashes agreeing on Offset.
+}
+
+// OffsetSeconds converts the match offset from frames to seconds.
+func (m Match) OffsetSeconds() float64 {
+	return float64(m.Offset) * fingerprint.HopSize / fingerprint.TargetSampleRate
+}
+
+// Time returns the wall-clock time at which the query starts in the track.
+// It reports false when the track has no start time.
+func (m Match) Time() (time.Time, bool) {
+	if m.Track.Start.IsZero() {
+		return time.Time{}, false
+	}
+	offset := time.Duration(m.Offset) * fingerprint.HopSize * time.Second / fingerprint.TargetSampleRate
+	return m.Track.Start.Add(offset), true
+}
+
+type posting struct {
+	track int32
+	frame int32
+}
+
+// Index is an in-memory inverted index from landmark hashes to the tracks
+// and frames they occur at.
+type Index struct {
+	tracks   []Track
+	postings map[uint32][]posting
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{postings: make(map[uint32][]posting)}
+}
+
+// Tracks returns the indexed tracks in insertion order.
+func (ix *Index) Tracks() []Track {
+	return ix.tracks
+}
+
+// Add stores the landmarks of a track and returns the track with its ID set.
+func (ix *Index) Add(track Track, landmarks []fingerprint.Landmark) Track {
+	track.ID = len(ix.tracks)
+	ix.tracks = append(ix.tracks, track)
+	for _, l := range landmarks {
+		ix.postings[l.Hash] = append(ix.postings[l.Hash], posting{
+			track: int32(track.ID),
+			frame: int32(l.Anchor.FrameIndex),
+		})
+	}
+	return track
+}
+
+// Match looks up the query landmarks and returns the track and offset that
+// the most hashes agree on. The match is only reported when it reaches
+// MinMatchScore and beats every other track or offset by MinMatchRatio;
+// offsets next to the best one are not counted as competitors.
+func (ix *Index) Match(landmarks []fingerprint.Landmark) (Match, bool) {
+	type key struct {
+		track int32
+		delta int32
+	}
+	counts := make(map[key]int)
+	for _, l := range landmarks {
+		for _, p := range ix.postings[l.Hash] {
+			counts[key{p.track, p.frame - int32(l.Anchor.FrameIndex)}]++
+		}
+	}
+
+	var best key
+	bestScore := 0
+	for k, c := range counts {
+		if c > bestScore || (c == bestScore && (k.track < best.track ||
+			(k.track == best.track && k.delta < best.delta))) {
+			best, bestScore = k, c
+		}
+	}
+	if bestScore == 0 {
+		return Match{Offset: -1}, false
+	}
+
+	runnerUp := 0
+	for k, c := range counts {
+		if k.track == best.track && k.delta >= best.delta-1 && k.delta <= best.delta+1 {
+			continue
+		}
+		runnerUp = max(runnerUp, c)
+	}
+
+	match := Match{
+		Track:  ix.tracks[best.track],
+		Offset: int(best.delta),
+		Score:  bestScore,
+	}
+	ok := bestScore >= MinMatchScore && float64(bestScore) >= MinMatchRatio*float64(runnerUp)
+	return match, ok
+}
@@ -0,0 +1,253 @@
+package index_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fingerprint/fingerprint"
+	"fingerprint/index"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// constellation builds landmarks from a deterministic pseudo-random set of peaks.
+func constellation(seed, frames int) []fingerprint.Landmark {
+	var peaks []fingerprint.Peak
+	x := uint32(seed*7919 + 1)
+	for f := 0; f < frames; f++ {
+		for b := 0; b < 3; b++ {
+			x = x*1664525 + 1013904223
+			peaks = append(peaks, fingerprint.Peak{FrameIndex: f, FreqBin: int(x>>23) % 512})
+		}
+	}
+	return fingerprint.Landmarks(peaks, 5)
+}
+
+// shift moves the landmarks of a query so it appears to start at frame offset.
+func shift(landmarks []fingerprint.Landmark, from, to, offset int) []fingerprint.Landmark {
+	var out []fingerprint.Landmark
+	for _, l := range landmarks {
+		if l.Anchor.FrameIndex >= from && l.Anchor.FrameIndex < to {
+			l.Anchor.FrameIndex -= offset
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func TestIndexMatch(t *testing.T) {
+	ix := index.New()
+	first := ix.Add(index.Track{Name: "first"}, constellation(1, 200))
+	second := ix.Add(index.Track{Name: "second"}, constellation(2, 200))
+	if first.ID != 0 || second.ID != 1 {
+		t.Fatalf("expected IDs 0 and 1, got %d and %d", first.ID, second.ID)
+	}
+
+	query := shift(constellation(2, 200), 50, 100, 50)
+	match, ok := ix.Match(query)
+	if !ok {
+		t.Fatalf("expected a match, got %+v", match)
+	}
+	if match.Track.Name != "second" {
+		t.Errorf("expected track second, got %s", match.Track.Name)
+	}
+	if match.Offset != 50 {
+		t.Errorf("expected offset 50, got %d", match.Offset)
+	}
+	want := 50.0 * fingerprint.HopSize / fingerprint.TargetSampleRate
+	if match.OffsetSeconds() != want {
+		t.Errorf("expected offset %f s, got %f s", want, match.OffsetSeconds())
+	}
+}
+
+func TestIndexNoMatch(t *testing.T) {
+	ix := index.New()
+	ix.Add(index.Track{Name: "first"}, constellation(1, 200))
+
+	if match, ok := ix.Match(constellation(3, 50)); ok {
+		t.Errorf("expected no match for unrelated query, got %+v", match)
+	}
+	if _, ok := ix.Match(nil); ok {
+		t.Error("expected no match for empty query")
+	}
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	ix := index.New()
+	ix.Add(index.Track{Name: "first"}, constellation(1, 200))
+	ix.Add(index.Track{Name: "second"}, constellation(2, 200))
+
+	var buf bytes.Buffer
+	if err := ix.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := index.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tracks()) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(loaded.Tracks()))
+	}
+
+	query := shift(constellation(2, 200), 50, 100, 50)
+	want, _ := ix.Match(query)
+	got, ok := loaded.Match(query)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v (ok=%v)", want, got, ok)
+	}
+}
+
+func TestIndexSaveDeterministic(t *testing.T) {
+	build := func() *index.Index {
+		ix := index.New()
+		metadata := map[string]string{"originator": "Studio 2", "loudness": "-23.0", "tempo": "120.00", "take": "3"}
+		ix.Add(index.Track{Name: "first", Metadata: metadata}, constellation(1, 200))
+		ix.Add(index.Track{Name: "second"}, constellation(2, 200))
+		return ix
+	}
+	var a, b bytes.Buffer
+	if err := build().Save(&a); err != nil {
+		t.Fatal(err)
+	}
+	if err := build().Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("expected the same index to save to the same bytes")
+	}
+
+	loaded, err := index.Load(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Tracks(), build().Tracks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected tracks %+v, got %+v", want, got)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	// The fields of the gob snapshot written by Save.
+	type track struct {
+		ID             int
+		Name           string
+		MetadataKeys   []string
+		MetadataValues []string
+	}
+	type snapshot struct {
+		Tracks []track
+		Hashes []uint32
+		IDs    []int32
+		Frames []int32
+	}
+	valid := func() snapshot {
+		return snapshot{
+			Tracks: []track{{ID: 0, Name: "first"}, {ID: 1, Name: "second", MetadataKeys: []string{"take"}, MetadataValues: []string{"3"}}},
+			Hashes: []uint32{7, 9},
+			IDs:    []int32{0, 1},
+			Frames: []int32{10, 20},
+		}
+	}
+	tests := []struct {
+		name    string
+		corrupt func(s *snapshot)
+		wantErr bool
+	}{
+		{"valid", func(s *snapshot) {}, false},
+		{"short IDs", func(s *snapshot) { s.IDs = s.IDs[:1] }, true},
+		{"short frames", func(s *snapshot) { s.Frames = nil }, true},
+		{"short metadata values", func(s *snapshot) { s.Tracks[1].MetadataValues = nil }, true},
+		{"track ID out of order", func(s *snapshot) { s.Tracks[1].ID = 5 }, true},
+		{"posting to a missing track", func(s *snapshot) { s.IDs[1] = 2 }, true},
+		{"negative posting track", func(s *snapshot) { s.IDs[0] = -1 }, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := valid()
+			tc.corrupt(&s)
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := index.Load(&buf); (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestIndexSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fingerprints.db")
+	if err := os.WriteFile(path, []byte("previous"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := index.New()
+	ix.Add(index.Track{Name: "first"}, constellation(1, 200))
+	if err := ix.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := index.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tracks()) != 1 {
+		t.Errorf("expected 1 track, got %d", len(loaded.Tracks()))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the mode of the replaced file to be kept, got %v, %v", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %d entries", len(entries))
+	}
+
+	// A save that cannot complete leaves the previous file alone.
+	if err := ix.SaveFile(filepath.Join(dir, "missing", "fingerprints.db")); err == nil {
+		t.Error("expected error for a missing directory")
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.SaveFile(sub); err == nil {
+		t.Error("expected error when replacing a directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected failed saves to clean up, got %d entries", len(entries))
+	}
+}
+
+func TestMatchTime(t *testing.T) {
+	start := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	ix := index.New()
+	ix.Add(index.Track{Name: "log", Start: start}, constellation(1, 400))
+	ix.Add(index.Track{Name: "untimed"}, constellation(2, 400))
+
+	match, ok := ix.Match(shift(constellation(1, 400), 200, 300, 200))
+	if !ok {
+		t.Fatalf("expected a match, got %+v", match)
+	}
+	got, ok := match.Time()
+	if !ok {
+		t.Fatal("expected a wall-clock time")
+	}
+	want := start.Add(time.Duration(200 * fingerprint.HopSize * int64(time.Second) / fingerprint.TargetSampleRate))
+	if d := got.Sub(want); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	match, ok = ix.Match(shift(constellation(2, 400), 200, 300, 200))
+	if !ok {
+		t.Fatalf("expected a match, got %+v", match)
+	}
+	if _, ok := match.Time(); ok {
+		t.Error("expected no wall-clock time for a track without a start")
+	}
+}
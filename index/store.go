@@ -0,0 +1,137 @@
+package index
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// snapshot is the serialised form of an Index. Postings are flattened into
+// parallel slices so that gob can encode them.
+type snapshot struct {
+	Tracks []storedTrack
+	Hashes []uint32
+	IDs    []int32
+	Frames []int32
+}
+
+// storedTrack is a Track with its metadata as pairs sorted by key, because
+// gob writes maps in random order.
+type storedTrack struct {
+	ID             int
+	Name           string
+	Start          time.Time
+	MetadataKeys   []string
+	MetadataValues []string
+}
+
+// Save writes the index to w. Tracks are written by ID and postings by
+// hash, so the same index always gives the same bytes.
+func (ix *Index) Save(w io.Writer) error {
+	s := snapshot{Tracks: make([]storedTrack, len(ix.tracks))}
+	tracks := slices.SortedFunc(slices.Values(ix.tracks), func(a, b Track) int { return a.ID - b.ID })
+	for i, t := range tracks {
+		st := storedTrack{ID: t.ID, Name: t.Name, Start: t.Start}
+		for _, key := range slices.Sorted(maps.Keys(t.Metadata)) {
+			st.MetadataKeys = append(st.MetadataKeys, key)
+			st.MetadataValues = append(st.MetadataValues, t.Metadata[key])
+		}
+		s.Tracks[i] = st
+	}
+	for _, hash := range slices.Sorted(maps.Keys(ix.postings)) {
+		for _, p := range ix.postings[hash] {
+			s.Hashes = append(s.Hashes, hash)
+			s.IDs = append(s.IDs, p.track)
+			s.Frames = append(s.Frames, p.frame)
+		}
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// SaveFile writes the index to path. It is written to a temporary file in
+// the same directory, synced and renamed over path, so a failed or
+// interrupted save leaves the previous file intact.
+func (ix *Index) SaveFile(path string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := ix.Save(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads an index written by Save. A snapshot whose slices disagree
+// or whose postings refer to missing tracks is an error.
+func Load(r io.Reader) (*Index, error) {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("corrupt index: %w", err)
+	}
+	ix := New()
+	ix.tracks = make([]Track, len(s.Tracks))
+	for i, st := range s.Tracks {
+		t := Track{ID: st.ID, Name: st.Name, Start: st.Start}
+		for j, key := range st.MetadataKeys {
+			if t.Metadata == nil {
+				t.Metadata = make(map[string]string, len(st.MetadataKeys))
+			}
+			t.Metadata[key] = st.MetadataValues[j]
+		}
+		ix.tracks[i] = t
+	}
+	for i, hash := range s.Hashes {
+		ix.postings[hash] = append(ix.postings[hash], posting{track: s.IDs[i], frame: s.Frames[i]})
+	}
+	return ix, nil
+}
+
+// validate checks the invariants that Load and Match index by.
+func (s *snapshot) validate() error {
+	if len(s.IDs) != len(s.Hashes) || len(s.Frames) != len(s.Hashes) {
+		return fmt.Errorf("%d hashes with %d track IDs and %d frames", len(s.Hashes), len(s.IDs), len(s.Frames))
+	}
+	for i, st := range s.Tracks {
+		if st.ID != i {
+			return fmt.Errorf("track %d has ID %d", i, st.ID)
+		}
+		if len(st.MetadataValues) != len(st.MetadataKeys) {
+			return fmt.Errorf("track %d has %d metadata keys and %d values", i, len(st.MetadataKeys), len(st.MetadataValues))
+		}
+	}
+	for i, id := range s.IDs {
+		if id < 0 || int(id) >= len(s.Tracks) {
+			return fmt.Errorf("posting %d refers to track %d of %d", i, id, len(s.Tracks))
+		}
+	}
+	return nil
+}
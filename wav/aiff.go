@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ReadAiffFile reads an AIFF or AIFF-C file from the given path, returning
+// mono samples as []int16 and the sample rate, like ReadWavFile. AIFF-C is
+// supported for uncompressed big- and little-endian PCM and 32/64-bit float.
+func ReadAiffFile(path string) ([]int16, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	channels, bitDepth, sampleRate, err := decodeAiff(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return downmix(channels, bitDepth), sampleRate, nil
+}
+
+// decodeAiff walks the chunks of an AIFF/AIFF-C file and returns the
+// samples of every channel with their bit depth and the sample rate.
+func decodeAiff(data []byte) ([][]int32, int, int, error) {
+	if len(data) < 12 || string(data[:4]) != "FORM" {
+		return nil, 0, 0, errors.New("invalid AIFF file")
+	}
+	form := string(data[8:12])
+	if form != "AIFF" && form != "AIFC" {
+		return nil, 0, 0, errors.New("invalid AIFF file")
+	}
+
+	var (
+		numChannels, sampleSize int
+		numFrames               uint32
+		sampleRate              float64
+		compression             = "NONE"
+		sound                   []byte
+		seenComm                bool
+	)
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+		switch id {
+		case "COMM":
+			if len(body) < 18 {
+				return nil, 0, 0, errors.New("aiff: short COMM chunk")
+			}
+			numChannels = int(binary.BigEndian.Uint16(body[0:2]))
+			numFrames = binary.BigEndian.Uint32(body[2:6])
+			sampleSize = int(binary.BigEndian.Uint16(body[6:8]))
+			sampleRate = extendedToFloat(body[8:18])
+			if form == "AIFC" && len(body) >= 22 {
+				compression = string(body[18:22])
+			}
+			seenComm = true
+		case "SSND":
+			if len(body) < 8 {
+				return nil, 0, 0, errors.New("aiff: short SSND chunk")
+			}
+			offset := int(binary.BigEndian.Uint32(body[0:4]))
+			if 8+offset > len(body) {
+				return nil, 0, 0, errors.New("aiff: invalid SSND offset")
+			}
+			sound = body[8+offset:]
+		}
+		// Chunks are padded to an even length.
+		pos += 8 + size + size&1
+	}
+	if !seenComm {
+		return nil, 0, 0, errors.New("aiff: missing COMM chunk")
+	}
+	if numChannels == 0 {
+		return nil, 0, 0, errors.New("aiff: no channels")
+	}
+
+	var (
+		width    int
+		bitDepth = sampleSize
+		decode   func(b []byte) int32
+	)
+	switch compression {
+	case "NONE", "twos", "sowt":
+		if sampleSize < 1 || sampleSize > 32 {
+			return nil, 0, 0, fmt.Errorf("aiff: unsupported sample size %d", sampleSize)
+		}
+		width = (sampleSize + 7) / 8
+		// Samples are left-justified within their bytes.
+		shift := width*8 - sampleSize
+		decode = func(b []byte) int32 {
+			var v uint32
+			for i := 0; i < width; i++ {
+				if compression == "sowt" {
+					v |= uint32(b[i]) << (8 * (4 - width + i))
+				} else {
+					v |= uint32(b[i]) << (8 * (3 - i))
+				}
+			}
+			return int32(v) >> (32 - width*8 + shift)
+		}
+	case "fl32", "FL32":
+		width, bitDepth = 4, 16
+		decode = func(b []byte) int32 {
+			return floatTo16(float64(math.Float32frombits(binary.BigEndian.Uint32(b))))
+		}
+	case "fl64", "FL64":
+		width, bitDepth = 8, 16
+		decode = func(b []byte) int32 {
+			return floatTo16(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		}
+	default:
+		return nil, 0, 0, fmt.Errorf("aiff: unsupported compression %q", compression)
+	}
+
+	frameBytes := width * numChannels
+	frames := min(int(numFrames), len(sound)/frameBytes)
+	channels := make([][]int32, numChannels)
+	for c := range channels {
+		channels[c] = make([]int32, frames)
+	}
+	for i := 0; i < frames; i++ {
+		for c := range channels {
+			off := i*frameBytes + c*width
+			channels[c][i] = decode(sound[off : off+width])
+		}
+	}
+	return channels, bitDepth, int(math.Round(sampleRate)), nil
+}
+
+// extendedToFloat decodes an IEEE 754 80-bit extended precision number,
+// which AIFF uses for the sample rate.
+func extendedToFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]))
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	sign := 1.0
+	if exponent&0x8000 != 0 {
+		sign = -1
+		exponent &= 0x7FFF
+	}
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+// floatTo16 converts a sample in [-1, 1] to 16 bits, saturating at the limits.
+func floatTo16(v float64) int32 {
+	return int32(math.Max(-32768, math.Min(32767, math.Round(v*32768))))
+}
@@ -0,0 +1,84 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ReadAudioFile reads a WAV, AIFF/AIFF-C, FLAC, MP3 or Ogg/Opus file, returning mono
+// samples as []int16 and the sample rate. The format is detected from the
+// magic bytes at the start of the file, not from its extension.
+func ReadAudioFile(path string) ([]int16, int, error) {
+	format, err := FileFormat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch format {
+	case "wav":
+		return ReadWavFile(path)
+	case "aiff":
+		return ReadAiffFile(path)
+	case "flac":
+		return ReadFlacFile(path)
+	case "mp3":
+		return ReadMp3File(path)
+	case "ogg":
+		return ReadOggFile(path)
+	}
+	return nil, 0, errors.New("unrecognised audio format")
+}
+
+// FileFormat returns the format of a file as detected by ReadAudioFile:
+// "wav", "aiff", "flac", "mp3", "ogg", or "" when it is not recognised.
+func FileFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	header = header[:n]
+
+	// Skip an ID3v2 tag and look at what follows it.
+	if n >= 10 && string(header[:3]) == "ID3" {
+		size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+		size += 10
+		if header[5]&0x10 != 0 {
+			size += 10
+		}
+		if _, err := f.Seek(size, io.SeekStart); err != nil {
+			return "", err
+		}
+		n, err = io.ReadFull(f, header)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		header = header[:n]
+	}
+	return sniffFormat(header), nil
+}
+
+// sniffFormat identifies an audio format from its first bytes.
+func sniffFormat(header []byte) string {
+	switch {
+	case len(header) >= 12 && string(header[8:12]) == "WAVE" &&
+		(string(header[:4]) == "RIFF" || string(header[:4]) == "RF64" || string(header[:4]) == "BW64"):
+		return "wav"
+	case len(header) >= 12 && string(header[:4]) == "FORM" &&
+		(string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC"):
+		return "aiff"
+	case len(header) >= 4 && string(header[:4]) == "fLaC":
+		return "flac"
+	case len(header) >= 4 && string(header[:4]) == "OggS":
+		return "ogg"
+	case isMp3Frame(header):
+		return "mp3"
+	}
+	return ""
+}
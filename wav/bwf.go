@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// bextFixedSize is the size of a bext chunk without its coding history.
+const bextFixedSize = 602
+
+// BextChunk is the Broadcast Wave Format extension chunk (EBU Tech 3285).
+type BextChunk struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	Origination         time.Time // Origination date and time, zero if not set.
+	TimeReference       uint64    // First sample, counted in samples since midnight.
+	Version             uint16
+	UMID                [64]byte
+	Loudness            *BextLoudness // Set from version 2 on.
+	CodingHistory       string
+}
+
+// BextLoudness holds the loudness values of a version 2 bext chunk, in
+// LUFS, LU and dBTP.
+type BextLoudness struct {
+	Integrated   float64
+	Range        float64
+	MaxTruePeak  float64
+	MaxMomentary float64
+	MaxShortTerm float64
+}
+
+// ParseBext decodes the body of a bext chunk.
+func ParseBext(data []byte) (*BextChunk, error) {
+	if len(data) < bextFixedSize {
+		return nil, errors.New("bext chunk too short")
+	}
+	b := &BextChunk{
+		Description:         bextString(data[0:256]),
+		Originator:          bextString(data[256:288]),
+		OriginatorReference: bextString(data[288:320]),
+		TimeReference:       binary.LittleEndian.Uint64(data[338:346]),
+		Version:             binary.LittleEndian.Uint16(data[346:348]),
+		CodingHistory:       bextString(data[bextFixedSize:]),
+	}
+	copy(b.UMID[:], data[348:412])
+	b.Origination = bextTime(data[320:330], data[330:338])
+	if b.Version >= 2 {
+		value := func(off int) float64 { return float64(int16(binary.LittleEndian.Uint16(data[off:]))) / 100 }
+		b.Loudness = &BextLoudness{
+			Integrated:   value(412),
+			Range:        value(414),
+			MaxTruePeak:  value(416),
+			MaxMomentary: value(418),
+			MaxShortTerm: value(420),
+		}
+	}
+	return b, nil
+}
+
+// StartTime returns the wall-clock time of the first sample: midnight of
+// the origination date plus the time reference at the file's sample rate.
+// BWF does not record a time zone, so the result is the recorder's clock
+// expressed in UTC. It reports false when the origination date is unset.
+func (b *BextChunk) StartTime(sampleRate int) (time.Time, bool) {
+	if b.Origination.IsZero() || sampleRate <= 0 {
+		return time.Time{}, false
+	}
+	y, m, d := b.Origination.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	seconds := b.TimeReference / uint64(sampleRate)
+	rest := b.TimeReference % uint64(sampleRate)
+	offset := time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(sampleRate)
+	return midnight.Add(offset), true
+}
+
+// bextString returns a NUL-padded ASCII field without its padding.
+func bextString(field []byte) string {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		field = field[:i]
+	}
+	return string(bytes.TrimRight(field, " \r\n"))
+}
+
+// bextTime parses the "yyyy-mm-dd" date and "hh-mm-ss" time fields. Any
+// separator character is accepted, as the specification allows. A
+// missing or malformed time is treated as midnight.
+func bextTime(date, clock []byte) time.Time {
+	num := func(b []byte) (int, bool) {
+		n, err := strconv.Atoi(string(b))
+		return n, err == nil
+	}
+	y, ok1 := num(date[0:4])
+	m, ok2 := num(date[5:7])
+	d, ok3 := num(date[8:10])
+	if !ok1 || !ok2 || !ok3 || m < 1 || m > 12 || d < 1 || d > 31 {
+		return time.Time{}
+	}
+	hh, ok1 := num(clock[0:2])
+	mm, ok2 := num(clock[3:5])
+	ss, ok3 := num(clock[6:8])
+	if !ok1 || !ok2 || !ok3 {
+		hh, mm, ss = 0, 0, 0
+	}
+	return time.Date(y, time.Month(m), d, hh, mm, ss, 0, time.UTC)
+}
+
+// IXML holds the commonly used fields of an iXML chunk.
+type IXML struct {
+	Project string      `xml:"PROJECT"`
+	Scene   string      `xml:"SCENE"`
+	Take    string      `xml:"TAKE"`
+	Tape    string      `xml:"TAPE"`
+	Note    string      `xml:"NOTE"`
+	Speed   IXMLSpeed   `xml:"SPEED"`
+	Tracks  []IXMLTrack `xml:"TRACK_LIST>TRACK"`
+}
+
+// IXMLSpeed is the SPEED section of an iXML chunk.
+type IXMLSpeed struct {
+	TimecodeRate   string `xml:"TIMECODE_RATE"`
+	TimecodeFlag   string `xml:"TIMECODE_FLAG"`
+	FileSampleRate int    `xml:"FILE_SAMPLE_RATE"`
+	TimestampHi    uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI"`
+	TimestampLo    uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO"`
+}
+
+// TimestampSamples returns the start of the file in samples since midnight.
+func (s IXMLSpeed) TimestampSamples() uint64 {
+	return uint64(s.TimestampHi)<<32 | uint64(s.TimestampLo)
+}
+
+// IXMLTrack names one channel of the file.
+type IXMLTrack struct {
+	ChannelIndex    int    `xml:"CHANNEL_INDEX"`
+	InterleaveIndex int    `xml:"INTERLEAVE_INDEX"`
+	Name            string `xml:"NAME"`
+	Function        string `xml:"FUNCTION"`
+}
+
+// ParseIXML decodes the body of an iXML chunk.
+func ParseIXML(data []byte) (*IXML, error) {
+	data = bytes.TrimRight(data, "\x00")
+	var doc IXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Bext returns the parsed bext chunk of the file, or nil when it has none.
+func (w *WavFile) Bext() (*BextChunk, error) {
+	for _, c := range w.Chunks {
+		if c.ID == "bext" {
+			return ParseBext(c.Data)
+		}
+	}
+	return nil, nil
+}
+
+// IXML returns the parsed iXML chunk of the file, or nil when it has none.
+func (w *WavFile) IXML() (*IXML, error) {
+	for _, c := range w.Chunks {
+		if c.ID == "iXML" {
+			return ParseIXML(c.Data)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,152 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// DownmixMode selects how multichannel audio is mixed to mono.
+type DownmixMode int
+
+const (
+	// DownmixAverage weights every channel equally.
+	DownmixAverage DownmixMode = iota
+	// DownmixITU uses the ITU-R BS.775 mono downmix weights for the
+	// speaker layout, dropping the LFE channel and attenuating the
+	// surrounds.
+	DownmixITU
+)
+
+// ReadOptions controls how a file is read and how its channels are
+// combined.
+type ReadOptions struct {
+	Channel int // 1-based channel to read on its own; 0 downmixes every channel.
+	Downmix DownmixMode
+	Strict  bool // Reject malformed WAV files instead of repairing them.
+}
+
+// Speaker position bits of the WAVE_FORMAT_EXTENSIBLE channel mask.
+const (
+	speakerFrontLeft          = 0x1
+	speakerFrontRight         = 0x2
+	speakerFrontCenter        = 0x4
+	speakerLowFrequency       = 0x8
+	speakerBackLeft           = 0x10
+	speakerBackRight          = 0x20
+	speakerFrontLeftOfCenter  = 0x40
+	speakerFrontRightOfCenter = 0x80
+	speakerBackCenter         = 0x100
+	speakerSideLeft           = 0x200
+	speakerSideRight          = 0x400
+)
+
+// defaultChannelMask returns the speaker layout implied by the channel
+// count when a file does not carry a channel mask.
+func defaultChannelMask(numChannels int) uint32 {
+	switch numChannels {
+	case 1:
+		return speakerFrontCenter
+	case 2:
+		return speakerFrontLeft | speakerFrontRight
+	case 3:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter
+	case 4:
+		return speakerFrontLeft | speakerFrontRight | speakerBackLeft | speakerBackRight
+	case 5:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter | speakerBackLeft | speakerBackRight
+	case 6:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter | speakerLowFrequency |
+			speakerBackLeft | speakerBackRight
+	case 8:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter | speakerLowFrequency |
+			speakerBackLeft | speakerBackRight | speakerSideLeft | speakerSideRight
+	}
+	return 0
+}
+
+// ituWeight returns the mono downmix weight of a speaker position. Left
+// and right fronts contribute half each, the centre and back centre
+// contribute -3 dB to both sides of the stereo downmix, and surrounds are
+// folded in at -3 dB before the stereo pair is averaged.
+func ituWeight(speaker uint32) float64 {
+	switch speaker {
+	case speakerFrontLeft, speakerFrontRight, speakerFrontLeftOfCenter, speakerFrontRightOfCenter:
+		return 0.5
+	case speakerFrontCenter:
+		return math.Sqrt2 / 2
+	case speakerLowFrequency:
+		return 0
+	case speakerBackCenter:
+		return 0.5
+	}
+	return math.Sqrt2 / 4
+}
+
+// ituWeights returns one weight per channel, normalised to sum to 1 so
+// that the downmix cannot clip. Channels are assigned to the set bits of
+// mask in ascending order; channels beyond the mask get no weight. When
+// the layout is unknown every channel is weighted equally.
+func ituWeights(numChannels int, mask uint32) []float64 {
+	if mask == 0 {
+		mask = defaultChannelMask(numChannels)
+	}
+	weights := make([]float64, numChannels)
+	if mask == 0 {
+		for c := range weights {
+			weights[c] = 1 / float64(numChannels)
+		}
+		return weights
+	}
+
+	sum := 0.0
+	c := 0
+	for bit := uint32(1); bit != 0 && c < numChannels; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		weights[c] = ituWeight(bit)
+		sum += weights[c]
+		c++
+	}
+	for c := range weights {
+		if sum > 0 {
+			weights[c] /= sum
+		}
+	}
+	return weights
+}
+
+// mixChannels applies opts to channels of the given bit depth.
+func mixChannels[S int16 | int32](channels [][]S, bitDepth int, mask uint32, opts ReadOptions) ([]int16, error) {
+	if opts.Channel != 0 {
+		if opts.Channel < 0 || opts.Channel > len(channels) {
+			return nil, fmt.Errorf("channel %d out of range: file has %d channels", opts.Channel, len(channels))
+		}
+		return downmix(channels[opts.Channel-1:opts.Channel], bitDepth), nil
+	}
+
+	switch opts.Downmix {
+	case DownmixAverage:
+		return downmix(channels, bitDepth), nil
+	case DownmixITU:
+		return weightedDownmix(channels, bitDepth, ituWeights(len(channels), mask)), nil
+	}
+	return nil, fmt.Errorf("unknown downmix mode %d", opts.Downmix)
+}
+
+// weightedDownmix scales the channels to 16 bits and mixes them with the
+// given weights.
+func weightedDownmix[S int16 | int32](channels [][]S, bitDepth int, weights []float64) []int16 {
+	if len(channels) == 0 {
+		return []int16{}
+	}
+	samples := make([]int16, len(channels[0]))
+	for i := range samples {
+		sum := 0.0
+		for c, ch := range channels {
+			sum += weights[c] * float64(scaleTo16(int32(ch[i]), bitDepth))
+		}
+		samples[i] = int16(max(math.MinInt16, min(math.MaxInt16, math.Round(sum))))
+	}
+	return samples
+}
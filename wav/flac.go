@@ -0,0 +1,550 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// FlacStreamInfo holds the fields of the mandatory STREAMINFO metadata block.
+type FlacStreamInfo struct {
+	MinBlockSize  int
+	MaxBlockSize  int
+	SampleRate    int
+	NumChannels   int
+	BitsPerSample int
+	TotalSamples  uint64 // Samples per channel, 0 when unknown.
+	MD5           [16]byte
+}
+
+var (
+	errFlacSync = errors.New("flac: lost frame sync")
+	errFlacCRC  = errors.New("flac: frame checksum mismatch")
+)
+
+// ReadFlacFile reads a FLAC file from the given path, returning mono
+// samples as []int16 and the sample rate, like ReadWavFile. Samples are
+// scaled to 16 bits. When the stream carries an MD5 signature of the
+// decoded audio it is verified.
+func ReadFlacFile(path string) ([]int16, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, channels, err := DecodeFlac(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return downmix(channels, info.BitsPerSample), info.SampleRate, nil
+}
+
+// DecodeFlac decodes a complete FLAC stream and returns its STREAMINFO and
+// the samples of every channel at their native bit depth.
+func DecodeFlac(data []byte) (FlacStreamInfo, [][]int32, error) {
+	data = skipID3v2(data)
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return FlacStreamInfo{}, nil, errors.New("flac: missing fLaC marker")
+	}
+	info, pos, err := readFlacMetadata(data, 4)
+	if err != nil {
+		return info, nil, err
+	}
+
+	// TotalSamples comes from the file, so it only sizes the buffers up to
+	// what the remaining data could plausibly hold.
+	channels := make([][]int32, info.NumChannels)
+	if capacity := min(info.TotalSamples, uint64(len(data)-pos)*8); capacity > 0 {
+		for c := range channels {
+			channels[c] = make([]int32, 0, capacity)
+		}
+	}
+	for pos < len(data) {
+		// Some encoders leave trailing padding or tags after the last frame.
+		if data[pos] != 0xFF {
+			break
+		}
+		n, err := decodeFlacFrame(data[pos:], info, channels)
+		if err != nil {
+			return info, nil, err
+		}
+		pos += n
+	}
+
+	if info.MD5 != [16]byte{} {
+		if md5Samples(channels, info.BitsPerSample) != info.MD5 {
+			return info, nil, errors.New("flac: MD5 signature mismatch")
+		}
+	}
+	return info, channels, nil
+}
+
+// skipID3v2 strips an ID3v2 tag that some taggers prepend to the stream.
+func skipID3v2(data []byte) []byte {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return data
+	}
+	size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+	size += 10
+	if data[5]&0x10 != 0 {
+		size += 10 // Footer present.
+	}
+	if size > len(data) {
+		return data[len(data):]
+	}
+	return data[size:]
+}
+
+// readFlacMetadata parses the metadata blocks starting at pos and returns
+// the STREAMINFO and the offset of the first audio frame.
+func readFlacMetadata(data []byte, pos int) (FlacStreamInfo, int, error) {
+	var info FlacStreamInfo
+	seenInfo := false
+	for {
+		if pos+4 > len(data) {
+			return info, pos, errors.New("flac: truncated metadata")
+		}
+		last := data[pos]&0x80 != 0
+		blockType := data[pos] & 0x7F
+		length := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		pos += 4
+		if pos+length > len(data) {
+			return info, pos, errors.New("flac: truncated metadata")
+		}
+		if blockType == 0 {
+			if length < 34 {
+				return info, pos, errors.New("flac: short STREAMINFO block")
+			}
+			b := data[pos : pos+34]
+			info.MinBlockSize = int(binary.BigEndian.Uint16(b[0:2]))
+			info.MaxBlockSize = int(binary.BigEndian.Uint16(b[2:4]))
+			packed := binary.BigEndian.Uint64(b[10:18])
+			info.SampleRate = int(packed >> 44)
+			info.NumChannels = int(packed>>41&0x7) + 1
+			info.BitsPerSample = int(packed>>36&0x1F) + 1
+			info.TotalSamples = packed & 0xFFFFFFFFF
+			copy(info.MD5[:], b[18:34])
+			seenInfo = true
+		}
+		pos += length
+		if last {
+			break
+		}
+	}
+	if !seenInfo {
+		return info, pos, errors.New("flac: missing STREAMINFO block")
+	}
+	if info.BitsPerSample < 4 || info.BitsPerSample > 32 {
+		return info, pos, fmt.Errorf("flac: unsupported bit depth %d", info.BitsPerSample)
+	}
+	return info, pos, nil
+}
+
+// Channel assignments from the frame header.
+const (
+	flacLeftSide  = 8
+	flacRightSide = 9
+	flacMidSide   = 10
+)
+
+// decodeFlacFrame decodes one audio frame, appends its samples to channels
+// and returns the number of bytes consumed.
+func decodeFlacFrame(data []byte, info FlacStreamInfo, channels [][]int32) (int, error) {
+	br := &bitReader{data: data}
+	if br.read(14) != 0x3FFE {
+		return 0, errFlacSync
+	}
+	br.read(2) // Reserved bit and blocking strategy.
+	blockCode := int(br.read(4))
+	rateCode := int(br.read(4))
+	assignment := int(br.read(4))
+	sizeCode := int(br.read(3))
+	br.read(1)
+	if err := br.skipUTF8(); err != nil {
+		return 0, err
+	}
+
+	blockSize := 0
+	switch {
+	case blockCode == 1:
+		blockSize = 192
+	case blockCode >= 2 && blockCode <= 5:
+		blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		blockSize = int(br.read(8)) + 1
+	case blockCode == 7:
+		blockSize = int(br.read(16)) + 1
+	case blockCode >= 8:
+		blockSize = 256 << (blockCode - 8)
+	default:
+		return 0, errors.New("flac: reserved block size")
+	}
+	switch rateCode {
+	case 12:
+		br.read(8)
+	case 13, 14:
+		br.read(16)
+	case 15:
+		return 0, errFlacSync
+	}
+
+	bps := info.BitsPerSample
+	if sizeCode != 0 {
+		sizes := [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+		bps = sizes[sizeCode]
+		if bps == 0 {
+			return 0, errors.New("flac: reserved sample size")
+		}
+	}
+
+	headerLen := br.bytePos()
+	if br.err != nil || headerLen >= len(data) {
+		return 0, errors.New("flac: truncated frame header")
+	}
+	if crc8(data[:headerLen]) != data[headerLen] {
+		return 0, errFlacCRC
+	}
+	br.read(8)
+
+	numChannels := assignment + 1
+	if assignment >= flacLeftSide {
+		if assignment > flacMidSide {
+			return 0, errors.New("flac: reserved channel assignment")
+		}
+		numChannels = 2
+	}
+	if numChannels != info.NumChannels {
+		return 0, errors.New("flac: channel count differs from STREAMINFO")
+	}
+
+	block := make([][]int32, numChannels)
+	for c := range block {
+		channelBps := bps
+		// The side channel needs one extra bit.
+		if (assignment == flacLeftSide && c == 1) || (assignment == flacRightSide && c == 0) ||
+			(assignment == flacMidSide && c == 1) {
+			channelBps++
+		}
+		samples, err := decodeSubframe(br, blockSize, channelBps)
+		if err != nil {
+			return 0, err
+		}
+		block[c] = samples
+	}
+	br.align()
+
+	switch assignment {
+	case flacLeftSide:
+		for i := range block[1] {
+			block[1][i] = block[0][i] - block[1][i]
+		}
+	case flacRightSide:
+		for i := range block[0] {
+			block[0][i] += block[1][i]
+		}
+	case flacMidSide:
+		for i := range block[0] {
+			mid, side := block[0][i]<<1|block[1][i]&1, block[1][i]
+			block[0][i] = (mid + side) >> 1
+			block[1][i] = (mid - side) >> 1
+		}
+	}
+
+	end := br.bytePos() + 2
+	if br.err != nil || end > len(data) {
+		return 0, errors.New("flac: truncated frame")
+	}
+	if crc16(data[:end-2]) != binary.BigEndian.Uint16(data[end-2:end]) {
+		return 0, errFlacCRC
+	}
+	for c := range channels {
+		channels[c] = append(channels[c], block[c]...)
+	}
+	return end, nil
+}
+
+// decodeSubframe decodes the samples of one channel in a frame.
+func decodeSubframe(br *bitReader, blockSize, bps int) ([]int32, error) {
+	if br.read(1) != 0 {
+		return nil, errors.New("flac: invalid subframe padding")
+	}
+	kind := int(br.read(6))
+	wasted := 0
+	if br.read(1) == 1 {
+		wasted = br.unary() + 1
+		bps -= wasted
+	}
+
+	samples := make([]int32, blockSize)
+	switch {
+	case kind == 0:
+		v := int32(br.readSigned(bps))
+		for i := range samples {
+			samples[i] = v
+		}
+	case kind == 1:
+		for i := range samples {
+			samples[i] = int32(br.readSigned(bps))
+		}
+	case kind >= 8 && kind <= 12:
+		order := kind - 8
+		if order > blockSize {
+			return nil, errors.New("flac: predictor order exceeds block size")
+		}
+		for i := 0; i < order; i++ {
+			samples[i] = int32(br.readSigned(bps))
+		}
+		if err := decodeResidual(br, samples, order); err != nil {
+			return nil, err
+		}
+		restoreFixed(samples, order)
+	case kind >= 32:
+		order := kind - 31
+		if order > blockSize {
+			return nil, errors.New("flac: predictor order exceeds block size")
+		}
+		for i := 0; i < order; i++ {
+			samples[i] = int32(br.readSigned(bps))
+		}
+		precision := int(br.read(4)) + 1
+		if precision == 16 {
+			return nil, errors.New("flac: invalid LPC precision")
+		}
+		shift := int(br.readSigned(5))
+		if shift < 0 {
+			return nil, errors.New("flac: negative LPC shift")
+		}
+		coeffs := make([]int64, order)
+		for i := range coeffs {
+			coeffs[i] = br.readSigned(precision)
+		}
+		if err := decodeResidual(br, samples, order); err != nil {
+			return nil, err
+		}
+		restoreLPC(samples, coeffs, shift)
+	default:
+		return nil, fmt.Errorf("flac: reserved subframe type %d", kind)
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return samples, nil
+}
+
+// decodeResidual reads Rice-coded residuals into samples[order:].
+func decodeResidual(br *bitReader, samples []int32, order int) error {
+	method := br.read(2)
+	if method > 1 {
+		return errors.New("flac: reserved residual coding method")
+	}
+	paramBits, escape := 4, uint64(0xF)
+	if method == 1 {
+		paramBits, escape = 5, 0x1F
+	}
+	partitionOrder := int(br.read(4))
+	partitions := 1 << partitionOrder
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize<<partitionOrder != len(samples) || partitionSize < order {
+		return errors.New("flac: invalid residual partition order")
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+		param := br.read(paramBits)
+		if param == escape {
+			bits := int(br.read(5))
+			for j := 0; j < n; j++ {
+				samples[i] = int32(br.readSigned(bits))
+				i++
+			}
+			continue
+		}
+		k := int(param)
+		for j := 0; j < n; j++ {
+			u := uint64(br.unary())<<k | br.read(k)
+			samples[i] = int32(u>>1) ^ -int32(u&1)
+			i++
+		}
+		if br.err != nil {
+			return br.err
+		}
+	}
+	return nil
+}
+
+// restoreFixed undoes the fixed polynomial predictors of order 0 to 4.
+func restoreFixed(s []int32, order int) {
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 1:
+			s[i] += s[i-1]
+		case 2:
+			s[i] += 2*s[i-1] - s[i-2]
+		case 3:
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+}
+
+// restoreLPC undoes a quantised linear predictor.
+func restoreLPC(s []int32, coeffs []int64, shift int) {
+	order := len(coeffs)
+	for i := order; i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * int64(s[i-1-j])
+		}
+		s[i] += int32(sum >> shift)
+	}
+}
+
+// md5Samples hashes the samples the way the encoder does: interleaved,
+// little-endian, in the smallest whole number of bytes per sample.
+func md5Samples(channels [][]int32, bps int) [16]byte {
+	h := md5.New()
+	width := (bps + 7) / 8
+	var buf bytes.Buffer
+	var b [4]byte
+	for i := range channels[0] {
+		for c := range channels {
+			binary.LittleEndian.PutUint32(b[:], uint32(channels[c][i]))
+			buf.Write(b[:width])
+		}
+		if buf.Len() >= 1<<16 {
+			h.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+	h.Write(buf.Bytes())
+	var sum [16]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// crc8 is the frame header checksum (polynomial x^8 + x^2 + x + 1).
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 is the frame checksum (polynomial x^16 + x^15 + x^2 + 1).
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// bitReader reads big-endian bit fields from a byte slice. Reading past the
+// end sets err and returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int // Position in bits.
+	err  error
+}
+
+func (br *bitReader) read(n int) uint64 {
+	var v uint64
+	for n > 0 {
+		idx := br.pos >> 3
+		if idx >= len(br.data) {
+			br.err = errors.New("flac: unexpected end of data")
+			return 0
+		}
+		avail := 8 - br.pos&7
+		take := min(avail, n)
+		bits := uint64(br.data[idx]>>(avail-take)) & (1<<take - 1)
+		v = v<<take | bits
+		br.pos += take
+		n -= take
+	}
+	return v
+}
+
+// readSigned reads an n-bit two's complement value.
+func (br *bitReader) readSigned(n int) int64 {
+	if n == 0 {
+		return 0
+	}
+	v := br.read(n)
+	return int64(v<<(64-n)) >> (64 - n)
+}
+
+// unary counts zero bits up to the next one bit.
+func (br *bitReader) unary() int {
+	n := 0
+	for {
+		idx := br.pos >> 3
+		if idx >= len(br.data) {
+			br.err = errors.New("flac: unexpected end of data")
+			return 0
+		}
+		// Skip whole zero bytes at once.
+		if br.pos&7 == 0 && br.data[idx] == 0 {
+			n += 8
+			br.pos += 8
+			continue
+		}
+		if br.read(1) == 1 {
+			return n
+		}
+		n++
+	}
+}
+
+// skipUTF8 skips the UTF-8 style coded frame or sample number.
+func (br *bitReader) skipUTF8() error {
+	first := br.read(8)
+	extra := 0
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		extra++
+	}
+	if extra == 1 || extra > 7 {
+		return errors.New("flac: invalid coded frame number")
+	}
+	if extra > 0 {
+		extra--
+	}
+	br.read(8 * extra)
+	return br.err
+}
+
+func (br *bitReader) align() {
+	br.pos = (br.pos + 7) &^ 7
+}
+
+func (br *bitReader) bytePos() int {
+	return br.pos >> 3
+}
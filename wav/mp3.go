@@ -0,0 +1,184 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3DecoderDelay is the delay in samples of the standard Layer III
+// synthesis filterbank, on top of the encoder delay in the LAME tag.
+const mp3DecoderDelay = 529
+
+// ReadMp3File reads an MPEG-1/2 Layer III file from the given path,
+// returning mono samples as []int16 and the sample rate, like ReadWavFile.
+// ID3v1 and ID3v2 tags are skipped. A Xing/Info or VBRI header frame is
+// removed, and when it carries a LAME tag the encoder delay and padding are
+// trimmed so that the samples line up with the original recording.
+func ReadMp3File(path string) ([]int16, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return DecodeMp3(data)
+}
+
+// DecodeMp3 decodes a complete MP3 stream into mono samples and the sample rate.
+func DecodeMp3(data []byte) ([]int16, int, error) {
+	for len(data) >= 10 && string(data[:3]) == "ID3" {
+		data = skipID3v2(data)
+	}
+	if len(data) >= 128 && string(data[len(data)-128:len(data)-125]) == "TAG" {
+		data = data[:len(data)-128]
+	}
+
+	info, frameLen := readVBRHeader(data)
+	if frameLen > 0 {
+		// The header frame holds no audio; decoding it would add silence.
+		data = data[frameLen:]
+	}
+
+	decoder, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	pcm, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The decoder always produces 16-bit little-endian stereo.
+	n := len(pcm) / 4
+	channels := [][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		channels[0][i] = int32(int16(binary.LittleEndian.Uint16(pcm[4*i:])))
+		channels[1][i] = int32(int16(binary.LittleEndian.Uint16(pcm[4*i+2:])))
+	}
+
+	start, end := 0, n
+	if info.frames > 0 {
+		end = min(end, info.frames*info.samplesPerFrame)
+	}
+	if info.gapless {
+		start = min(info.delay+mp3DecoderDelay, n)
+		end = min(start+info.frames*info.samplesPerFrame-info.delay-info.padding, n)
+	}
+	if end < start {
+		end = start
+	}
+	for c := range channels {
+		channels[c] = channels[c][start:end]
+	}
+	return downmix(channels, 16), decoder.SampleRate(), nil
+}
+
+// vbrInfo is what the Xing/Info, LAME and VBRI headers tell about the stream.
+type vbrInfo struct {
+	frames          int // Audio frames, excluding the header frame; 0 when unknown.
+	samplesPerFrame int
+	gapless         bool // Encoder delay and padding are known.
+	delay           int
+	padding         int
+}
+
+// readVBRHeader inspects the first frame of the stream. When it is a
+// Xing/Info or VBRI header frame it returns the parsed header and the
+// length of the frame in bytes, otherwise a zero length.
+func readVBRHeader(data []byte) (vbrInfo, int) {
+	var info vbrInfo
+	if len(data) < 4 || data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return info, 0
+	}
+	version := data[1] >> 3 & 0x3 // 3: MPEG-1, 2: MPEG-2, 0: MPEG-2.5.
+	layer := data[1] >> 1 & 0x3
+	protected := data[1]&0x1 == 0
+	bitrateIndex := int(data[2] >> 4)
+	rateIndex := int(data[2] >> 2 & 0x3)
+	padded := int(data[2] >> 1 & 0x1)
+	mono := data[3]>>6 == 3
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return info, 0
+	}
+
+	mpeg1 := version == 3
+	bitrates := [2][15]int{
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	rates := [3]int{44100, 48000, 32000}
+	sampleRate := rates[rateIndex]
+	info.samplesPerFrame = 1152
+	bitrate := bitrates[0][bitrateIndex]
+	sideInfo := 17
+	if mono {
+		sideInfo = 9
+	}
+	if mpeg1 {
+		bitrate = bitrates[1][bitrateIndex]
+		sideInfo = 32
+		if mono {
+			sideInfo = 17
+		}
+	} else {
+		info.samplesPerFrame = 576
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+	}
+	frameLen := info.samplesPerFrame/8*bitrate*1000/sampleRate + padded
+
+	xing := 4 + sideInfo
+	if protected {
+		xing += 2
+	}
+	switch {
+	case xing+8 <= len(data) && (string(data[xing:xing+4]) == "Xing" || string(data[xing:xing+4]) == "Info"):
+		flags := binary.BigEndian.Uint32(data[xing+4:])
+		pos := xing + 8
+		if flags&0x1 != 0 && pos+4 <= len(data) {
+			info.frames = int(binary.BigEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+		if flags&0x2 != 0 {
+			pos += 4 // Stream size in bytes.
+		}
+		if flags&0x4 != 0 {
+			pos += 100 // Seek table.
+		}
+		if flags&0x8 != 0 {
+			pos += 4 // Quality indicator.
+		}
+		// The LAME tag starts with a 9-byte encoder name; delay and
+		// padding are two 12-bit values 21 bytes into it.
+		if info.frames > 0 && pos+24 <= min(len(data), frameLen) && data[pos] != 0 {
+			b := data[pos+21 : pos+24]
+			info.delay = int(b[0])<<4 | int(b[1])>>4
+			info.padding = int(b[1]&0xF)<<8 | int(b[2])
+			info.gapless = true
+		}
+	case 36+18 <= len(data) && string(data[36:40]) == "VBRI":
+		info.frames = int(binary.BigEndian.Uint32(data[36+14:]))
+	default:
+		return info, 0
+	}
+	if frameLen > len(data) {
+		return info, 0
+	}
+	return info, frameLen
+}
+
+// isMp3Frame reports whether the bytes start with an MPEG Layer III frame header.
+func isMp3Frame(header []byte) bool {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := header[1] >> 3 & 0x3
+	layer := header[1] >> 1 & 0x3
+	bitrateIndex := header[2] >> 4
+	rateIndex := header[2] >> 2 & 0x3
+	return version != 1 && layer == 1 && bitrateIndex != 15 && rateIndex != 3
+}
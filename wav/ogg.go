@@ -0,0 +1,184 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errOggCRC = errors.New("ogg: page checksum mismatch")
+
+// OggPage is one page of an Ogg bitstream.
+type OggPage struct {
+	HeaderType byte
+	Granule    int64 // Granule position, -1 when no packet ends on this page.
+	Serial     uint32
+	Sequence   uint32
+	Lacing     []byte // Segment table.
+	Body       []byte
+}
+
+// Continued reports whether the first packet continues from the previous page.
+func (p OggPage) Continued() bool { return p.HeaderType&0x1 != 0 }
+
+// BOS reports whether this is the first page of a logical bitstream.
+func (p OggPage) BOS() bool { return p.HeaderType&0x2 != 0 }
+
+// EOS reports whether this is the last page of a logical bitstream.
+func (p OggPage) EOS() bool { return p.HeaderType&0x4 != 0 }
+
+// ReadOggPage reads and verifies the next page from r.
+func ReadOggPage(r io.Reader) (OggPage, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return OggPage{}, err
+	}
+	if string(header[:4]) != "OggS" {
+		return OggPage{}, errors.New("ogg: missing capture pattern")
+	}
+	if header[4] != 0 {
+		return OggPage{}, errors.New("ogg: unsupported stream structure version")
+	}
+	lacing := make([]byte, header[26])
+	if _, err := io.ReadFull(r, lacing); err != nil {
+		return OggPage{}, io.ErrUnexpectedEOF
+	}
+	size := 0
+	for _, l := range lacing {
+		size += int(l)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return OggPage{}, io.ErrUnexpectedEOF
+	}
+
+	want := binary.LittleEndian.Uint32(header[22:26])
+	binary.LittleEndian.PutUint32(header[22:26], 0)
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, lacing)
+	crc = oggCRC(crc, body)
+	if crc != want {
+		return OggPage{}, errOggCRC
+	}
+
+	return OggPage{
+		HeaderType: header[5],
+		Granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		Serial:     binary.LittleEndian.Uint32(header[14:18]),
+		Sequence:   binary.LittleEndian.Uint32(header[18:22]),
+		Lacing:     lacing,
+		Body:       body,
+	}, nil
+}
+
+// OggReader reassembles the packets of the first logical bitstream in an
+// Ogg file. Pages of other multiplexed streams are skipped.
+type OggReader struct {
+	r       *bufio.Reader
+	serial  uint32
+	locked  bool
+	partial []byte
+	packets [][]byte
+	granule int64 // Granule position of the page the last queued packet ends on.
+	lastSeq uint32
+	eos     bool
+	skip    bool // Discarding the rest of a packet whose start was lost.
+}
+
+// NewOggReader returns a reader for the packets of the stream in r.
+func NewOggReader(r io.Reader) *OggReader {
+	return &OggReader{r: bufio.NewReader(r)}
+}
+
+// NextPacket returns the next complete packet. granule is the granule
+// position of the page that completes the packet when it is the last packet
+// finished on that page, and -1 otherwise. At the end of the stream it
+// returns io.EOF.
+func (o *OggReader) NextPacket() (packet []byte, granule int64, err error) {
+	for len(o.packets) == 0 {
+		if o.eos {
+			return nil, -1, io.EOF
+		}
+		if err := o.readPage(); err != nil {
+			return nil, -1, err
+		}
+	}
+	packet = o.packets[0]
+	o.packets = o.packets[1:]
+	granule = -1
+	if len(o.packets) == 0 {
+		granule = o.granule
+	}
+	return packet, granule, nil
+}
+
+func (o *OggReader) readPage() error {
+	page, err := ReadOggPage(o.r)
+	if err != nil {
+		if err == io.EOF && len(o.partial) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if !o.locked {
+		if !page.BOS() {
+			return errors.New("ogg: stream does not start with a BOS page")
+		}
+		o.serial, o.locked = page.Serial, true
+	} else if page.Serial != o.serial {
+		return nil
+	} else if page.Sequence != o.lastSeq+1 {
+		// A page was lost; drop the packet that spanned the gap, including
+		// its tail on this and any following continued pages.
+		o.partial = nil
+		o.skip = page.Continued()
+	}
+	o.lastSeq = page.Sequence
+	if !page.Continued() {
+		o.partial, o.skip = nil, false
+	}
+
+	offset := 0
+	for _, l := range page.Lacing {
+		segment := page.Body[offset : offset+int(l)]
+		offset += int(l)
+		if o.skip {
+			o.skip = l == 255
+			continue
+		}
+		o.partial = append(o.partial, segment...)
+		// A lacing value below 255 terminates the packet.
+		if l < 255 {
+			o.packets = append(o.packets, o.partial)
+			o.partial = nil
+		}
+	}
+	o.granule = page.Granule
+	o.eos = page.EOS()
+	return nil
+}
+
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggCRC updates the page checksum (polynomial 0x04C11DB7, no reflection).
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
@@ -0,0 +1,119 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pion/opus"
+)
+
+// OpusSampleRate is the rate Opus streams are always decoded at.
+const OpusSampleRate = 48000
+
+// opusMaxFrame is the largest number of samples per channel in one packet (120 ms).
+const opusMaxFrame = OpusSampleRate * 120 / 1000
+
+// ReadOggFile reads an Ogg file from the given path, returning mono
+// samples as []int16 and the sample rate, like ReadWavFile. Ogg/Opus is
+// supported; Opus always decodes at 48 kHz, so the samples must be
+// resampled before fingerprinting, which Fingerprint does.
+func ReadOggFile(path string) ([]int16, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return DecodeOgg(f)
+}
+
+// DecodeOgg decodes the first logical bitstream of an Ogg stream.
+func DecodeOgg(r io.Reader) ([]int16, int, error) {
+	ogg := NewOggReader(r)
+	head, _, err := ogg.NextPacket()
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("OpusHead")):
+		return decodeOpus(ogg, head)
+	case bytes.HasPrefix(head, []byte("\x01vorbis")):
+		return nil, 0, errors.New("ogg: Vorbis streams are not supported")
+	}
+	return nil, 0, errors.New("ogg: unknown codec")
+}
+
+// decodeOpus decodes the packets following the OpusHead identification
+// header, removes the pre-skip and trims the end to the final granule position.
+func decodeOpus(ogg *OggReader, head []byte) ([]int16, int, error) {
+	if len(head) < 19 {
+		return nil, 0, errors.New("opus: short OpusHead")
+	}
+	if head[8]>>4 != 0 {
+		return nil, 0, errors.New("opus: unsupported OpusHead version")
+	}
+	numChannels := int(head[9])
+	preSkip := int(binary.LittleEndian.Uint16(head[10:12]))
+	gain := int16(binary.LittleEndian.Uint16(head[16:18]))
+	if family := head[18]; family != 0 && (len(head) < 21 || head[19] != 1) {
+		return nil, 0, errors.New("opus: multistream channel mappings are not supported")
+	}
+	if numChannels < 1 || numChannels > 2 {
+		return nil, 0, errors.New("opus: unsupported channel count")
+	}
+
+	decoder, err := opus.NewDecoderWithOutput(OpusSampleRate, numChannels)
+	if err != nil {
+		return nil, 0, err
+	}
+	channels := make([][]int32, numChannels)
+	out := make([]int16, opusMaxFrame*numChannels)
+	lastGranule := int64(-1)
+	for first := true; ; first = false {
+		packet, granule, err := ogg.NextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if granule >= 0 {
+			lastGranule = granule
+		}
+		if first && bytes.HasPrefix(packet, []byte("OpusTags")) {
+			continue
+		}
+		n, err := decoder.DecodeToInt16(packet, out)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := 0; i < n; i++ {
+			for c := range channels {
+				channels[c] = append(channels[c], int32(out[i*numChannels+c]))
+			}
+		}
+	}
+
+	total := len(channels[0])
+	start := min(preSkip, total)
+	end := total
+	if lastGranule >= 0 {
+		end = min(end, int(lastGranule))
+	}
+	end = max(end, start)
+
+	// The output gain is a Q7.8 value in dB.
+	scale := math.Pow(10, float64(gain)/(20*256))
+	for c := range channels {
+		channels[c] = channels[c][start:end]
+		if gain != 0 {
+			for i, v := range channels[c] {
+				channels[c][i] = floatTo16(float64(v) * scale / 32768)
+			}
+		}
+	}
+	return downmix(channels, 16), OpusSampleRate, nil
+}
@@ -0,0 +1,70 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// RawFormat describes headerless PCM audio.
+type RawFormat struct {
+	Encoding    string // One of s16le, s24le, s32le or f32le.
+	SampleRate  int
+	NumChannels int
+}
+
+// ReadRawPCM reads interleaved headerless PCM from r until EOF and returns
+// mono samples as []int16, like ReadWavFile. A trailing partial frame,
+// as left by an interrupted capture, is ignored.
+func ReadRawPCM(r io.Reader, format RawFormat) ([]int16, error) {
+	if format.NumChannels < 1 {
+		return nil, errors.New("raw: channel count must be positive")
+	}
+	if format.SampleRate <= 0 {
+		return nil, errors.New("raw: sample rate must be positive")
+	}
+
+	var (
+		width    int
+		bitDepth int
+		decode   func(b []byte) int32
+	)
+	switch format.Encoding {
+	case "s16le":
+		width, bitDepth = 2, 16
+		decode = func(b []byte) int32 { return int32(int16(binary.LittleEndian.Uint16(b))) }
+	case "s24le":
+		width, bitDepth = 3, 24
+		decode = func(b []byte) int32 { return int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8 }
+	case "s32le":
+		width, bitDepth = 4, 32
+		decode = func(b []byte) int32 { return int32(binary.LittleEndian.Uint32(b)) }
+	case "f32le":
+		width, bitDepth = 4, 16
+		decode = func(b []byte) int32 {
+			return floatTo16(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		}
+	default:
+		return nil, fmt.Errorf("raw: unsupported encoding %q", format.Encoding)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	frameBytes := width * format.NumChannels
+	frames := len(data) / frameBytes
+	channels := make([][]int32, format.NumChannels)
+	for c := range channels {
+		channels[c] = make([]int32, frames)
+	}
+	for i := 0; i < frames; i++ {
+		for c := range channels {
+			off := i*frameBytes + c*width
+			channels[c][i] = decode(data[off : off+width])
+		}
+	}
+	return downmix(channels, bitDepth), nil
+}
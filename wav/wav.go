@@ -1,51 +1,423 @@
 package audio
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+)
+
+// WavFile is a decoded WAV, RF64 or BW64 file.
+type WavFile struct {
+	NumChannels   int
+	SampleRate    int
+	BitsPerSample int
+	ChannelMask   uint32      // Speaker layout from WAVE_FORMAT_EXTENSIBLE, or 0.
+	Channels      [][]int16   // Samples of every channel, at 2 bytes each like the file.
+	Chunks        []RiffChunk // Chunks other than fmt, data and ds64, e.g. LIST, bext or iXML.
+	Warnings      []WavWarning
+}
 
-	"github.com/go-audio/wav"
+// RiffChunk is an uninterpreted chunk of a RIFF file.
+type RiffChunk struct {
+	ID   string
+	Data []byte
+}
+
+// WavWarningKind classifies a problem repaired while parsing.
+type WavWarningKind int
+
+const (
+	WarnSizeMismatch    WavWarningKind = iota // RIFF size disagrees with the file length.
+	WarnTruncatedChunk                        // A chunk extends past the end of the file.
+	WarnTruncatedData                         // The data chunk extends past the end of the file.
+	WarnUnsizedData                           // The data chunk size was never filled in.
+	WarnMisalignedChunk                       // A chunk starts one byte off, from a missing or extra pad byte.
+	WarnPartialFrame                          // The data ends in the middle of a sample frame.
+	WarnTrailingGarbage                       // Bytes after the last chunk are not a chunk.
+	WarnMissingDS64                           // An RF64/BW64 file has no ds64 chunk.
 )
 
+var warningNames = [...]string{
+	WarnSizeMismatch:    "size mismatch",
+	WarnTruncatedChunk:  "truncated chunk",
+	WarnTruncatedData:   "truncated data",
+	WarnUnsizedData:     "unsized data",
+	WarnMisalignedChunk: "misaligned chunk",
+	WarnPartialFrame:    "partial frame",
+	WarnTrailingGarbage: "trailing garbage",
+	WarnMissingDS64:     "missing ds64",
+}
+
+func (k WavWarningKind) String() string {
+	if int(k) < len(warningNames) {
+		return warningNames[k]
+	}
+	return fmt.Sprintf("WavWarningKind(%d)", int(k))
+}
+
+// WavWarning describes a problem found at a byte offset of the file and
+// how it was repaired.
+type WavWarning struct {
+	Kind    WavWarningKind
+	Offset  int64
+	Message string
+}
+
+func (w WavWarning) String() string {
+	return fmt.Sprintf("%s at offset %d: %s", w.Kind, w.Offset, w.Message)
+}
+
 // ReadWavFile reads a 16-bit PCM WAV file from the given path,
-// returning mono samples as []int16 and the sample rate.
+// returning mono samples as []int16 and the sample rate. All channels are
+// averaged.
 func ReadWavFile(path string) ([]int16, int, error) {
-	f, err := os.Open(path)
+	return ReadWavFileWithOptions(path, ReadOptions{})
+}
+
+// ReadWavFileWithOptions is like ReadWavFile but selects a single channel
+// or a downmix mode, and with opts.Strict rejects malformed files.
+// DownmixITU uses the WAVE_FORMAT_EXTENSIBLE channel mask when the file has
+// one and the conventional layout for the channel count otherwise.
+func ReadWavFileWithOptions(path string, opts ReadOptions) ([]int16, int, error) {
+	wav, err := ReadWav(path, opts.Strict)
+	if err != nil {
+		return nil, 0, err
+	}
+	samples, err := wav.Mono(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return samples, wav.SampleRate, nil
+}
+
+// ReadWavChannels reads a 16-bit PCM WAV file and returns every channel
+// separately, so that each can be fingerprinted on its own.
+func ReadWavChannels(path string) ([][]int16, int, error) {
+	wav, err := ReadWav(path, false)
 	if err != nil {
 		return nil, 0, err
 	}
+	return wav.Split(), wav.SampleRate, nil
+}
+
+// ReadWav reads a WAV file from the given path. See ParseWav.
+func ReadWav(path string, strict bool) (*WavFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ParseWav(f, info.Size(), strict)
+}
+
+// Mono mixes the channels to 16-bit mono according to opts.
+func (w *WavFile) Mono(opts ReadOptions) ([]int16, error) {
+	return mixChannels(w.Channels, w.BitsPerSample, w.ChannelMask, opts)
+}
+
+// Split returns every channel as 16-bit samples, sharing Channels.
+func (w *WavFile) Split() [][]int16 {
+	return w.Channels
+}
+
+// ParseWav decodes a 16-bit PCM RIFF/WAVE file of the given size. RF64
+// and BW64 files, whose sizes are stored in a ds64 chunk, are read the
+// same way. Chunks may appear in any order.
+//
+// The parser recovers as much audio as it can from truncated data, wrong
+// or unset sizes and chunks that are off by a pad byte, and records what
+// it repaired in Warnings. With strict, any such inconsistency is an error
+// instead.
+func ParseWav(r io.ReaderAt, size int64, strict bool) (*WavFile, error) {
+	p := wavParser{r: r, size: size, strict: strict}
+	return p.parse()
+}
+
+type wavParser struct {
+	r        io.ReaderAt
+	size     int64
+	strict   bool
+	warnings []WavWarning
+}
 
-	decoder := wav.NewDecoder(f)
-	if !decoder.IsValidFile() {
-		return nil, 0, errors.New("invalid WAV file")
+// warn records a repair, or fails in strict mode.
+func (p *wavParser) warn(kind WavWarningKind, offset int64, format string, args ...any) error {
+	w := WavWarning{Kind: kind, Offset: offset, Message: fmt.Sprintf(format, args...)}
+	if p.strict {
+		return fmt.Errorf("invalid WAV file: %s", w)
 	}
-	// Only support PCM 16-bit.
-	if decoder.BitDepth != 16 {
-		return nil, 0, errors.New("only 16-bit PCM WAV files are supported")
+	p.warnings = append(p.warnings, w)
+	return nil
+}
+
+func (p *wavParser) readAt(n int, off int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := p.r.ReadAt(buf, off); err != nil {
+		return nil, err
 	}
+	return buf, nil
+}
 
-	// Decode the entire file.
-	buf, err := decoder.FullPCMBuffer()
+// chunkHeader returns the ID and 32-bit size of the chunk header at off,
+// and whether the ID is printable ASCII as chunk IDs must be.
+func (p *wavParser) chunkHeader(off int64) (string, uint32, bool) {
+	if off < 0 || off+8 > p.size {
+		return "", 0, false
+	}
+	header, err := p.readAt(8, off)
 	if err != nil {
-		return nil, 0, err
+		return "", 0, false
+	}
+	for _, b := range header[:4] {
+		if b < 0x20 || b > 0x7E {
+			return "", 0, false
+		}
 	}
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), true
+}
 
-	samples := make([]int16, 0, len(buf.Data)/buf.Format.NumChannels)
-	if buf.Format.NumChannels == 1 {
-		for _, v := range buf.Data {
-			samples = append(samples, int16(v))
+func (p *wavParser) parse() (*WavFile, error) {
+	header, err := p.readAt(12, 0)
+	if err != nil || string(header[8:]) != "WAVE" {
+		return nil, errors.New("invalid WAV file")
+	}
+	id := string(header[:4])
+	if id != "RIFF" && id != "RF64" && id != "BW64" {
+		return nil, errors.New("invalid WAV file")
+	}
+	riffEnd := int64(binary.LittleEndian.Uint32(header[4:])) + 8
+
+	// RF64 and BW64 store the RIFF and data sizes, and those of any other
+	// chunk over 4 GB, as 64-bit values in a ds64 chunk that comes first.
+	var (
+		dataSize64 int64 = -1
+		sizes            = map[string]int64{}
+	)
+	off := int64(12)
+	if id != "RIFF" {
+		cid, csize, ok := p.chunkHeader(off)
+		if ok && cid == "ds64" && csize >= 28 && int64(csize) <= p.size-off-8 {
+			ds64, err := p.readAt(int(csize), off+8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid WAV file: %w", err)
+			}
+			riffEnd = int64(binary.LittleEndian.Uint64(ds64)) + 8
+			dataSize64 = int64(binary.LittleEndian.Uint64(ds64[8:]))
+			table := ds64[28:]
+			for n := binary.LittleEndian.Uint32(ds64[24:]); n > 0 && len(table) >= 12; n-- {
+				sizes[string(table[:4])] = int64(binary.LittleEndian.Uint64(table[4:]))
+				table = table[12:]
+			}
+			off += 8 + int64(csize) + int64(csize&1)
+		} else {
+			if err := p.warn(WarnMissingDS64, off, "%s file without ds64 chunk, using 32-bit sizes", id); err != nil {
+				return nil, err
+			}
+			riffEnd = p.size
+		}
+	}
+
+	end := riffEnd
+	if riffEnd > p.size {
+		if err := p.warn(WarnSizeMismatch, 4, "RIFF size covers %d bytes but the file has %d", riffEnd, p.size); err != nil {
+			return nil, err
+		}
+		end = p.size
+	} else if !p.strict {
+		// Writers that crash before finalising the header leave a RIFF
+		// size that is too small; keep looking for chunks past it.
+		end = p.size
+	}
+
+	var (
+		wav        = &WavFile{}
+		haveFmt    bool
+		dataOffset int64 = -1
+		dataSize   int64
+		prevOdd    bool
+		pastRiff   bool
+	)
+	for off+8 <= end {
+		cid, csize32, ok := p.chunkHeader(off)
+		if !ok {
+			// A writer that omitted or added a pad byte shifts every
+			// following chunk by one.
+			shifted := off + 1
+			if prevOdd {
+				shifted = off - 1
+			}
+			if cid, csize32, ok = p.chunkHeader(shifted); ok {
+				if err := p.warn(WarnMisalignedChunk, off, "chunk %q found at offset %d", cid, shifted); err != nil {
+					return nil, err
+				}
+				off = shifted
+			} else {
+				if off < riffEnd {
+					if err := p.warn(WarnTrailingGarbage, off, "no chunk header, ignoring the remaining %d bytes", end-off); err != nil {
+						return nil, err
+					}
+				}
+				break
+			}
+		}
+		if off >= riffEnd && !pastRiff {
+			pastRiff = true
+			if err := p.warn(WarnSizeMismatch, off, "chunk %q found after the RIFF size of %d bytes", cid, riffEnd); err != nil {
+				return nil, err
+			}
 		}
-	} else {
-		// Downmix stereo to mono by averaging the channels.
-		for i := 0; i < len(buf.Data); i += buf.Format.NumChannels {
-			sum := 0
-			for c := 0; c < buf.Format.NumChannels; c++ {
-				sum += int(buf.Data[i+c])
+
+		csize := int64(csize32)
+		if csize32 == 0xFFFFFFFF && id != "RIFF" {
+			if cid == "data" && dataSize64 >= 0 {
+				csize = dataSize64
+			} else if s, ok := sizes[cid]; ok {
+				csize = s
 			}
-			avg := int16(sum / buf.Format.NumChannels)
-			samples = append(samples, avg)
 		}
+		body := off + 8
+		available := end - body
+
+		switch cid {
+		case "fmt ":
+			if csize < 16 || csize > available {
+				return nil, errors.New("invalid WAV file: truncated fmt chunk")
+			}
+			data, err := p.readAt(int(min(csize, 40)), body)
+			if err != nil {
+				return nil, err
+			}
+			if err := wav.parseFmt(data); err != nil {
+				return nil, err
+			}
+			haveFmt = true
+		case "data":
+			if (csize == 0 || (csize32 == 0xFFFFFFFF && id == "RIFF")) && available > 0 {
+				if _, _, next := p.chunkHeader(body); !next || csize != 0 {
+					if err := p.warn(WarnUnsizedData, off, "data chunk size %d, using the remaining %d bytes", csize, available); err != nil {
+						return nil, err
+					}
+					csize = available
+				}
+			}
+			if csize > available {
+				if err := p.warn(WarnTruncatedData, off, "data chunk of %d bytes has only %d", csize, available); err != nil {
+					return nil, err
+				}
+				csize = available
+			}
+			dataOffset, dataSize = body, csize
+		case "ds64":
+		default:
+			if csize > available {
+				if err := p.warn(WarnTruncatedChunk, off, "%q chunk of %d bytes has only %d", cid, csize, available); err != nil {
+					return nil, err
+				}
+				csize = available
+			}
+			data, err := p.readAt(int(csize), body)
+			if err != nil {
+				return nil, err
+			}
+			wav.Chunks = append(wav.Chunks, RiffChunk{ID: cid, Data: data})
+		}
+		prevOdd = csize&1 == 1
+		off = body + csize + csize&1
+	}
+
+	if !haveFmt {
+		return nil, errors.New("invalid WAV file: no fmt chunk")
+	}
+	if dataOffset < 0 {
+		return nil, errors.New("invalid WAV file: no data chunk")
+	}
+	if err := p.readData(wav, dataOffset, dataSize); err != nil {
+		return nil, err
+	}
+	wav.Warnings = p.warnings
+	return wav, nil
+}
+
+// parseFmt reads the format chunk. Only 16-bit integer PCM is supported,
+// either as WAVE_FORMAT_PCM or as WAVE_FORMAT_EXTENSIBLE with the PCM
+// subformat.
+func (w *WavFile) parseFmt(data []byte) error {
+	format := binary.LittleEndian.Uint16(data)
+	w.NumChannels = int(binary.LittleEndian.Uint16(data[2:]))
+	w.SampleRate = int(binary.LittleEndian.Uint32(data[4:]))
+	w.BitsPerSample = int(binary.LittleEndian.Uint16(data[14:]))
+	if format == 0xFFFE && len(data) >= 40 {
+		w.ChannelMask = binary.LittleEndian.Uint32(data[20:])
+		format = binary.LittleEndian.Uint16(data[24:])
+	}
+	if w.NumChannels < 1 || w.SampleRate < 1 {
+		return errors.New("invalid WAV file: bad fmt chunk")
+	}
+	if format != 1 || w.BitsPerSample != 16 {
+		return errors.New("only 16-bit PCM WAV files are supported")
+	}
+	return nil
+}
+
+// readData decodes size bytes of interleaved samples at off into one
+// slice per channel.
+func (p *wavParser) readData(w *WavFile, off, size int64) error {
+	frameBytes := int64(w.NumChannels * 2)
+	frames := size / frameBytes
+	if size%frameBytes != 0 {
+		if err := p.warn(WarnPartialFrame, off+size, "dropping %d bytes of an incomplete frame", size%frameBytes); err != nil {
+			return err
+		}
+	}
+
+	w.Channels = make([][]int16, w.NumChannels)
+	for c := range w.Channels {
+		w.Channels[c] = make([]int16, frames)
+	}
+	const blockFrames = 1 << 14
+	buf := make([]byte, blockFrames*frameBytes)
+	for start := int64(0); start < frames; start += blockFrames {
+		n := min(blockFrames, frames-start)
+		block := buf[:n*frameBytes]
+		if _, err := p.r.ReadAt(block, off+start*frameBytes); err != nil {
+			return err
+		}
+		for i := int64(0); i < n; i++ {
+			for c := range w.Channels {
+				w.Channels[c][start+i] = int16(binary.LittleEndian.Uint16(block[i*frameBytes+int64(c)*2:]))
+			}
+		}
+	}
+	return nil
+}
+
+// downmix scales the channels to 16 bits and averages them into one
+// mono signal.
+func downmix[S int16 | int32](channels [][]S, bitDepth int) []int16 {
+	if len(channels) == 0 {
+		return []int16{}
+	}
+	samples := make([]int16, len(channels[0]))
+	for i := range samples {
+		sum := 0
+		for _, ch := range channels {
+			sum += int(scaleTo16(int32(ch[i]), bitDepth))
+		}
+		samples[i] = int16(sum / len(channels))
+	}
+	return samples
+}
+
+// scaleTo16 converts a sample of the given bit depth to 16 bits.
+func scaleTo16(v int32, bitDepth int) int16 {
+	if bitDepth > 16 {
+		return int16(v >> (bitDepth - 16))
 	}
-	return samples, buf.Format.SampleRate, nil
+	return int16(v << (16 - bitDepth))
 }
@@ -1,9 +1,17 @@
 package audio_test
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fingerprint/fingerprint"
 	audio "fingerprint/wav"
+	"io"
+	"math"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	audioWav "github.com/go-audio/audio"
 	"github.com/go-audio/wav"
@@ -137,6 +145,366 @@ func TestReadWavFile_Stereo(t *testing.T) {
 	}
 }
 
+// wavFmt returns the body of a 16-bit PCM format chunk. A non-zero mask
+// makes it WAVE_FORMAT_EXTENSIBLE.
+func wavFmt(numChannels, sampleRate int, mask uint32) []byte {
+	body := binary.LittleEndian.AppendUint16(nil, 1)
+	if mask != 0 {
+		body = binary.LittleEndian.AppendUint16(nil, 0xFFFE)
+	}
+	body = binary.LittleEndian.AppendUint16(body, uint16(numChannels))
+	body = binary.LittleEndian.AppendUint32(body, uint32(sampleRate))
+	body = binary.LittleEndian.AppendUint32(body, uint32(sampleRate*numChannels*2))
+	body = binary.LittleEndian.AppendUint16(body, uint16(numChannels*2))
+	body = binary.LittleEndian.AppendUint16(body, 16)
+	if mask != 0 {
+		body = binary.LittleEndian.AppendUint16(body, 22)
+		body = binary.LittleEndian.AppendUint16(body, 16)
+		body = binary.LittleEndian.AppendUint32(body, mask)
+		// KSDATAFORMAT_SUBTYPE_PCM
+		body = append(body, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+			0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71)
+	}
+	return body
+}
+
+func pcmData(samples []int16) []byte {
+	var data []byte
+	for _, v := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(v))
+	}
+	return data
+}
+
+// riffChunk returns a chunk header with the given size followed by body.
+// No pad byte is added.
+func riffChunk(id string, size uint32, body []byte) []byte {
+	out := binary.LittleEndian.AppendUint32([]byte(id), size)
+	return append(out, body...)
+}
+
+// riffFile wraps chunks in a RIFF header. A negative size writes the
+// correct RIFF size.
+func riffFile(id string, size int64, chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	if size < 0 {
+		size = int64(4 + len(body))
+	}
+	out := binary.LittleEndian.AppendUint32([]byte(id), uint32(size))
+	out = append(out, "WAVE"...)
+	return append(out, body...)
+}
+
+// encodeWav builds a 16-bit PCM WAV file. A non-zero mask writes a
+// WAVE_FORMAT_EXTENSIBLE format chunk carrying it.
+func encodeWav(numChannels, sampleRate int, mask uint32, samples []int16) []byte {
+	fmtChunk := wavFmt(numChannels, sampleRate, mask)
+	data := pcmData(samples)
+	return riffFile("RIFF", -1,
+		riffChunk("fmt ", uint32(len(fmtChunk)), fmtChunk),
+		riffChunk("data", uint32(len(data)), data))
+}
+
+// Test that a single channel can be read when the channels cancel out.
+func TestReadWavFile_ChannelSelection(t *testing.T) {
+	path := writeTemp(t, "inverted*.wav", encodeWav(2, 44100, 0, []int16{1000, -1000, -2000, 2000}))
+
+	mixed, _, err := audio.ReadWavFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mixed, []int16{0, 0}) {
+		t.Errorf("expected phase-inverted channels to cancel, got %v", mixed)
+	}
+
+	right, _, err := audio.ReadWavFileWithOptions(path, audio.ReadOptions{Channel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(right, []int16{-1000, 2000}) {
+		t.Errorf("expected right channel [-1000 2000], got %v", right)
+	}
+
+	channels, sampleRate, err := audio.ReadWavChannels(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("expected sample rate 44100, got %d", sampleRate)
+	}
+	if !reflect.DeepEqual(channels, [][]int16{{1000, -2000}, {-1000, 2000}}) {
+		t.Errorf("unexpected channels %v", channels)
+	}
+
+	if _, _, err := audio.ReadWavFileWithOptions(path, audio.ReadOptions{Channel: 3}); err == nil {
+		t.Error("expected error for out-of-range channel")
+	}
+}
+
+// Test the ITU downmix with and without a channel mask.
+func TestReadWavFile_ITUDownmix(t *testing.T) {
+	itu := audio.ReadOptions{Downmix: audio.DownmixITU}
+
+	// 5.1 in the conventional order: L R C LFE Ls Rs. Only the LFE is
+	// loud, and the ITU downmix must drop it.
+	path := writeTemp(t, "surround*.wav", encodeWav(6, 48000, 0, []int16{0, 0, 0, 20000, 0, 0}))
+	samples, _, err := audio.ReadWavFileWithOptions(path, itu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples[0] != 0 {
+		t.Errorf("expected LFE to be dropped, got %d", samples[0])
+	}
+
+	// The same six channels with a mask that puts the fourth channel on
+	// the back left instead of the LFE.
+	const mask = 0x1 | 0x2 | 0x4 | 0x10 | 0x20 | 0x200
+	path = writeTemp(t, "masked*.wav", encodeWav(6, 48000, mask, []int16{0, 0, 0, 20000, 0, 0}))
+	samples, _, err = audio.ReadWavFileWithOptions(path, itu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Weights before normalisation: fronts 0.5, centre and surrounds
+	// sqrt(2)/2 and sqrt(2)/4.
+	sum := 1 + math.Sqrt2/2 + 3*math.Sqrt2/4
+	want := int16(math.Round(20000 * math.Sqrt2 / 4 / sum))
+	if samples[0] != want {
+		t.Errorf("expected %d from the masked surround channel, got %d", want, samples[0])
+	}
+
+	// For plain stereo the ITU downmix is the average.
+	path = writeTemp(t, "stereo*.wav", encodeWav(2, 48000, 0, []int16{1000, 3000}))
+	samples, _, err = audio.ReadWavFileWithOptions(path, itu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(samples, []int16{2000}) {
+		t.Errorf("expected [2000], got %v", samples)
+	}
+}
+
+// Test that malformed files are repaired by default with the expected
+// warnings, and rejected in strict mode.
+func TestParseWav_Repair(t *testing.T) {
+	fmtBody := wavFmt(2, 8000, 0)
+	fmtChunk := riffChunk("fmt ", uint32(len(fmtBody)), fmtBody)
+	data := pcmData([]int16{1, -1, 2, -2, 3, -3})
+
+	tests := []struct {
+		name     string
+		file     []byte
+		expected [][]int16
+		warnings []audio.WavWarningKind
+		chunks   []string
+	}{
+		{
+			// Cut in the middle of the third frame.
+			name:     "truncated data",
+			file:     riffFile("RIFF", -1, fmtChunk, riffChunk("data", uint32(len(data)), data))[:44+10],
+			expected: [][]int16{{1, 2}, {-1, -2}},
+			warnings: []audio.WavWarningKind{audio.WarnSizeMismatch, audio.WarnTruncatedData, audio.WarnPartialFrame},
+		},
+		{
+			// Sizes left at zero by a recorder that never finalised the header.
+			name:     "unsized data",
+			file:     riffFile("RIFF", 0, fmtChunk, riffChunk("data", 0, data)),
+			expected: [][]int16{{1, 2, 3}, {-1, -2, -3}},
+			warnings: []audio.WavWarningKind{audio.WarnSizeMismatch, audio.WarnUnsizedData},
+		},
+		{
+			// RIFF size left covering only the fmt chunk.
+			name:     "short RIFF size",
+			file:     riffFile("RIFF", int64(4+len(fmtChunk)), fmtChunk, riffChunk("data", uint32(len(data)), data)),
+			expected: [][]int16{{1, 2, 3}, {-1, -2, -3}},
+			warnings: []audio.WavWarningKind{audio.WarnSizeMismatch},
+		},
+		{
+			// Metadata before fmt, with an odd-sized chunk missing its pad byte.
+			name: "misaligned chunk",
+			file: riffFile("RIFF", -1,
+				riffChunk("LIST", 4, []byte("INFO")),
+				riffChunk("bext", 3, []byte("abc")),
+				fmtChunk,
+				riffChunk("data", uint32(len(data)), data)),
+			expected: [][]int16{{1, 2, 3}, {-1, -2, -3}},
+			warnings: []audio.WavWarningKind{audio.WarnMisalignedChunk},
+			chunks:   []string{"LIST", "bext"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := audio.ParseWav(bytes.NewReader(tc.file), int64(len(tc.file)), true); err == nil {
+				t.Error("expected strict parsing to fail")
+			}
+
+			wav, err := audio.ParseWav(bytes.NewReader(tc.file), int64(len(tc.file)), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(wav.Channels, tc.expected) {
+				t.Errorf("expected channels %v, got %v", tc.expected, wav.Channels)
+			}
+			var kinds []audio.WavWarningKind
+			for _, w := range wav.Warnings {
+				kinds = append(kinds, w.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tc.warnings) {
+				t.Errorf("expected warnings %v, got %v", tc.warnings, wav.Warnings)
+			}
+			var ids []string
+			for _, c := range wav.Chunks {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.chunks) {
+				t.Errorf("expected chunks %v, got %v", tc.chunks, ids)
+			}
+
+			if _, _, err := audio.ReadAudioFile(writeTemp(t, "field*.wav", tc.file)); err != nil {
+				t.Errorf("expected ReadAudioFile to repair the file, got %v", err)
+			}
+		})
+	}
+}
+
+// Test that RF64 and BW64 files take their sizes from the ds64 chunk.
+func TestParseWav_RF64(t *testing.T) {
+	fmtBody := wavFmt(1, 8000, 0)
+	data := pcmData([]int16{10, 20, 30})
+	for _, id := range []string{"RF64", "BW64"} {
+		t.Run(id, func(t *testing.T) {
+			ds64 := binary.LittleEndian.AppendUint64(nil, uint64(4+36+8+len(fmtBody)+8+len(data)))
+			ds64 = binary.LittleEndian.AppendUint64(ds64, uint64(len(data)))
+			ds64 = binary.LittleEndian.AppendUint64(ds64, 3)
+			ds64 = binary.LittleEndian.AppendUint32(ds64, 0)
+			file := riffFile(id, 0xFFFFFFFF,
+				riffChunk("ds64", uint32(len(ds64)), ds64),
+				riffChunk("fmt ", uint32(len(fmtBody)), fmtBody),
+				riffChunk("data", 0xFFFFFFFF, data))
+
+			wav, err := audio.ParseWav(bytes.NewReader(file), int64(len(file)), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(wav.Channels, [][]int16{{10, 20, 30}}) {
+				t.Errorf("unexpected channels %v", wav.Channels)
+			}
+			if len(wav.Warnings) != 0 {
+				t.Errorf("unexpected warnings %v", wav.Warnings)
+			}
+
+			samples, _, err := audio.ReadAudioFile(writeTemp(t, "long*.wav", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(samples, []int16{10, 20, 30}) {
+				t.Errorf("expected [10 20 30], got %v", samples)
+			}
+		})
+	}
+}
+
+// encodeBext builds a bext chunk body with a coding history.
+func encodeBext(originator, date, clock string, timeReference uint64, version uint16) []byte {
+	body := make([]byte, 602)
+	copy(body[0:], "Morning news")
+	copy(body[256:], originator)
+	copy(body[288:], "REF-0001")
+	copy(body[320:], date)
+	copy(body[330:], clock)
+	binary.LittleEndian.PutUint64(body[338:], timeReference)
+	binary.LittleEndian.PutUint16(body[346:], version)
+	if version >= 2 {
+		// Integrated loudness -23 LUFS and maximum true peak -1.5 dBTP.
+		for i, v := range []int16{-2300, 0, -150} {
+			binary.LittleEndian.PutUint16(body[412+2*i:], uint16(v))
+		}
+	}
+	return append(body, "A=PCM,F=48000,W=16,M=mono\r\n"...)
+}
+
+func TestParseWav_BWF(t *testing.T) {
+	fmtBody := wavFmt(1, 48000, 0)
+	// 09:30:00.5 at 48 kHz.
+	bext := encodeBext("Studio 2", "2026:03:14", "09-31-00", (9*3600+30*60)*48000+24000, 2)
+	ixml := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML>
+  <PROJECT>Evening</PROJECT><SCENE>12</SCENE><TAKE>3</TAKE>
+  <SPEED>
+    <FILE_SAMPLE_RATE>48000</FILE_SAMPLE_RATE>
+    <TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>1</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>
+    <TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>2</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>
+  </SPEED>
+  <TRACK_LIST><TRACK><CHANNEL_INDEX>1</CHANNEL_INDEX><NAME>BOOM</NAME></TRACK></TRACK_LIST>
+</BWFXML>` + "\x00")
+	data := pcmData([]int16{1, 2})
+	file := riffFile("RIFF", -1,
+		append(riffChunk("bext", uint32(len(bext)), bext), 0), // Odd size, so padded.
+		riffChunk("iXML", uint32(len(ixml)), ixml),
+		riffChunk("fmt ", uint32(len(fmtBody)), fmtBody),
+		riffChunk("data", uint32(len(data)), data))
+
+	wav, err := audio.ParseWav(bytes.NewReader(file), int64(len(file)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := wav.Bext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b == nil {
+		t.Fatal("expected a bext chunk")
+	}
+	if b.Description != "Morning news" || b.Originator != "Studio 2" || b.OriginatorReference != "REF-0001" {
+		t.Errorf("unexpected text fields %q %q %q", b.Description, b.Originator, b.OriginatorReference)
+	}
+	if want := time.Date(2026, 3, 14, 9, 31, 0, 0, time.UTC); !b.Origination.Equal(want) {
+		t.Errorf("expected origination %v, got %v", want, b.Origination)
+	}
+	if b.CodingHistory != "A=PCM,F=48000,W=16,M=mono" {
+		t.Errorf("unexpected coding history %q", b.CodingHistory)
+	}
+	if b.Loudness == nil || b.Loudness.Integrated != -23 || b.Loudness.MaxTruePeak != -1.5 {
+		t.Errorf("unexpected loudness %+v", b.Loudness)
+	}
+	start, ok := b.StartTime(wav.SampleRate)
+	if want := time.Date(2026, 3, 14, 9, 30, 0, 500_000_000, time.UTC); !ok || !start.Equal(want) {
+		t.Errorf("expected start %v, got %v (ok=%v)", want, start, ok)
+	}
+
+	x, err := wav.IXML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x == nil || x.Project != "Evening" || x.Scene != "12" || x.Take != "3" {
+		t.Fatalf("unexpected iXML %+v", x)
+	}
+	if x.Speed.FileSampleRate != 48000 || x.Speed.TimestampSamples() != 1<<32|2 {
+		t.Errorf("unexpected speed %+v", x.Speed)
+	}
+	if len(x.Tracks) != 1 || x.Tracks[0].Name != "BOOM" || x.Tracks[0].ChannelIndex != 1 {
+		t.Errorf("unexpected tracks %+v", x.Tracks)
+	}
+
+	// A version 0 chunk has no loudness and an unset date has no start.
+	b, err = audio.ParseBext(encodeBext("", "", "", 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Loudness != nil {
+		t.Errorf("expected no loudness, got %+v", b.Loudness)
+	}
+	if _, ok := b.StartTime(48000); ok {
+		t.Error("expected no start time without an origination date")
+	}
+	if _, err := audio.ParseBext(make([]byte, 100)); err == nil {
+		t.Error("expected error for short bext chunk")
+	}
+}
+
 // Test reading a WAV file with an unsupported bit depth (e.g., 8-bit).
 func TestReadWavFile_WrongBitDepth(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "wrongbitdepth*.wav")
@@ -170,3 +538,735 @@ func TestReadWavFile_WrongBitDepth(t *testing.T) {
 		t.Error("expected error for 8-bit WAV file, got nil")
 	}
 }
+
+// bitWriter packs big-endian bit fields for the FLAC test encoder.
+type bitWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n int) {
+	w.write(uint64(v)&(1<<uint(n)-1), n)
+}
+
+func (w *bitWriter) align() {
+	for w.nbits%8 != 0 {
+		w.write(0, 1)
+	}
+}
+
+func testCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func testCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// writeRice writes the residual with a single partition and Rice parameter k.
+func writeRice(w *bitWriter, residual []int64, k int) {
+	w.write(0, 2) // 4-bit Rice parameters.
+	w.write(0, 4) // Partition order 0.
+	w.write(uint64(k), 4)
+	for _, r := range residual {
+		u := uint64(r<<1) ^ uint64(r>>63)
+		for q := u >> uint(k); q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(u&(1<<uint(k)-1), k)
+	}
+}
+
+// writeSubframe encodes one channel of a block with the given subframe kind:
+// "verbatim", "constant", "fixed" (order 2) or "lpc" (order 2).
+func writeSubframe(w *bitWriter, samples []int64, bps int, kind string) {
+	w.write(0, 1)
+	switch kind {
+	case "constant":
+		w.write(0, 6)
+		w.write(0, 1)
+		w.writeSigned(samples[0], bps)
+	case "verbatim":
+		w.write(1, 6)
+		w.write(0, 1)
+		for _, s := range samples {
+			w.writeSigned(s, bps)
+		}
+	case "fixed":
+		w.write(8+2, 6)
+		w.write(0, 1)
+		w.writeSigned(samples[0], bps)
+		w.writeSigned(samples[1], bps)
+		residual := make([]int64, 0, len(samples)-2)
+		for i := 2; i < len(samples); i++ {
+			residual = append(residual, samples[i]-2*samples[i-1]+samples[i-2])
+		}
+		writeRice(w, residual, 4)
+	case "lpc":
+		coeffs, precision, shift := []int64{7, -3}, 5, 2
+		w.write(32+1, 6)
+		w.write(0, 1)
+		w.writeSigned(samples[0], bps)
+		w.writeSigned(samples[1], bps)
+		w.write(uint64(precision-1), 4)
+		w.writeSigned(int64(shift), 5)
+		for _, c := range coeffs {
+			w.writeSigned(c, precision)
+		}
+		residual := make([]int64, 0, len(samples)-2)
+		for i := 2; i < len(samples); i++ {
+			pred := (coeffs[0]*samples[i-1] + coeffs[1]*samples[i-2]) >> uint(shift)
+			residual = append(residual, samples[i]-pred)
+		}
+		writeRice(w, residual, 6)
+	}
+}
+
+// encodeFlac builds a FLAC stream with one frame per entry of kinds, cycling
+// through the stereo decorrelation modes when there are two channels.
+func encodeFlac(channels [][]int64, sampleRate, bps, blockSize int, kinds []string) []byte {
+	n := len(channels[0])
+	var pcm bytes.Buffer
+	for i := 0; i < n; i++ {
+		for _, ch := range channels {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], uint32(ch[i]))
+			pcm.Write(b[:(bps+7)/8])
+		}
+	}
+	sum := md5.Sum(pcm.Bytes())
+
+	out := []byte("fLaC")
+	info := &bitWriter{}
+	info.write(uint64(blockSize), 16)
+	info.write(uint64(blockSize), 16)
+	info.write(0, 24)
+	info.write(0, 24)
+	info.write(uint64(sampleRate), 20)
+	info.write(uint64(len(channels)-1), 3)
+	info.write(uint64(bps-1), 5)
+	info.write(uint64(n), 36)
+	out = append(out, 0x80, 0, 0, 34)
+	out = append(out, info.buf...)
+	out = append(out, sum[:]...)
+
+	for f := 0; f*blockSize < n; f++ {
+		start, end := f*blockSize, min((f+1)*blockSize, n)
+		assignment := len(channels) - 1
+		block := make([][]int64, len(channels))
+		for c := range channels {
+			block[c] = channels[c][start:end]
+		}
+		sideBits := []int{0, 0}
+		if len(channels) == 2 && f%4 != 0 {
+			l, r := block[0], block[1]
+			a, b := make([]int64, len(l)), make([]int64, len(l))
+			for i := range l {
+				switch f % 4 {
+				case 1: // Left/side.
+					a[i], b[i] = l[i], l[i]-r[i]
+				case 2: // Side/right.
+					a[i], b[i] = l[i]-r[i], r[i]
+				case 3: // Mid/side.
+					a[i], b[i] = (l[i]+r[i])>>1, l[i]-r[i]
+				}
+			}
+			block = [][]int64{a, b}
+			assignment = 7 + f%4
+			sideBits = map[int][]int{1: {0, 1}, 2: {1, 0}, 3: {0, 1}}[f%4]
+		}
+
+		w := &bitWriter{}
+		w.write(0x3FFE, 14)
+		w.write(0, 2)
+		w.write(7, 4) // 16-bit block size at the end of the header.
+		w.write(0, 4) // Sample rate from STREAMINFO.
+		w.write(uint64(assignment), 4)
+		w.write(0, 3) // Sample size from STREAMINFO.
+		w.write(0, 1)
+		w.write(uint64(f), 8) // Frame number, always below 128 here.
+		w.write(uint64(end-start-1), 16)
+		w.write(uint64(testCRC8(w.buf)), 8)
+		for c := range block {
+			writeSubframe(w, block[c], bps+sideBits[c%len(sideBits)], kinds[f%len(kinds)])
+		}
+		w.align()
+		w.write(uint64(testCRC16(w.buf)), 16)
+		out = append(out, w.buf...)
+	}
+	return out
+}
+
+func writeTemp(t *testing.T, pattern string, data []byte) string {
+	t.Helper()
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	return f.Name()
+}
+
+// Test decoding a stereo 16-bit FLAC file with every subframe type and
+// stereo decorrelation mode, and downmixing it to mono.
+func TestReadFlacFile_Stereo(t *testing.T) {
+	n := 1000
+	left, right := make([]int64, n), make([]int64, n)
+	for i := range left {
+		left[i] = int64(12000 * math.Sin(float64(i)*0.05))
+		right[i] = int64(-9000*math.Sin(float64(i)*0.031)) + 7
+	}
+	// Make the constant-subframe frame actually constant.
+	for i := 400; i < 500; i++ {
+		left[i], right[i] = -5, -5
+	}
+	kinds := []string{"verbatim", "fixed", "lpc", "fixed", "constant", "lpc", "verbatim", "lpc"}
+	data := encodeFlac([][]int64{left, right}, 44100, 16, 100, kinds)
+
+	info, channels, err := audio.DecodeFlac(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SampleRate != 44100 || info.NumChannels != 2 || info.BitsPerSample != 16 || info.TotalSamples != uint64(n) {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+	for i := 0; i < n; i++ {
+		if int64(channels[0][i]) != left[i] || int64(channels[1][i]) != right[i] {
+			t.Fatalf("sample %d: expected (%d, %d), got (%d, %d)", i, left[i], right[i], channels[0][i], channels[1][i])
+		}
+	}
+
+	samples, sampleRate, err := audio.ReadFlacFile(writeTemp(t, "stereo*.flac", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("expected sample rate 44100, got %d", sampleRate)
+	}
+	if len(samples) != n {
+		t.Fatalf("expected %d samples, got %d", n, len(samples))
+	}
+	for i, v := range samples {
+		if want := int16((left[i] + right[i]) / 2); v != want {
+			t.Fatalf("sample %d: expected %d, got %d", i, want, v)
+		}
+	}
+}
+
+// Test that 24-bit FLAC samples are scaled down to 16 bits.
+func TestReadFlacFile_24Bit(t *testing.T) {
+	mono := []int64{0x7FFF00, -0x800000, 0x123456, 256, -256, 0}
+	data := encodeFlac([][]int64{mono}, 96000, 24, 4, []string{"fixed", "verbatim"})
+
+	samples, sampleRate, err := audio.ReadFlacFile(writeTemp(t, "hires*.flac", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 96000 {
+		t.Errorf("expected sample rate 96000, got %d", sampleRate)
+	}
+	expected := []int16{0x7FFF, -0x8000, 0x1234, 1, -1, 0}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected %v, got %v", expected, samples)
+	}
+}
+
+// Test that corrupted audio is detected by the frame CRC or the MD5 signature.
+func TestReadFlacFile_Corrupt(t *testing.T) {
+	mono := make([]int64, 64)
+	for i := range mono {
+		mono[i] = int64(i * 100)
+	}
+	data := encodeFlac([][]int64{mono}, 44100, 16, 64, []string{"verbatim"})
+
+	badSum := append([]byte(nil), data...)
+	badSum[8+18] ^= 0xFF // First byte of the MD5 signature.
+	if _, _, err := audio.DecodeFlac(badSum); err == nil {
+		t.Error("expected MD5 mismatch error, got nil")
+	}
+
+	badFrame := append([]byte(nil), data...)
+	badFrame[len(badFrame)-10] ^= 0x01
+	if _, _, err := audio.DecodeFlac(badFrame); err == nil {
+		t.Error("expected frame checksum error, got nil")
+	}
+
+	if _, _, err := audio.DecodeFlac([]byte("RIFF....WAVE")); err == nil {
+		t.Error("expected error for non-FLAC data, got nil")
+	}
+
+	// A total sample count of 2^36-1 must not be allocated up front.
+	huge := append([]byte(nil), data...)
+	huge[8+13] |= 0x0F
+	copy(huge[8+14:8+18], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	info, channels, err := audio.DecodeFlac(huge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.TotalSamples != 1<<36-1 || len(channels[0]) != len(mono) || cap(channels[0]) > len(huge)*8 {
+		t.Errorf("expected %d samples in a small buffer, got %d of capacity %d (%+v)", len(mono), len(channels[0]), cap(channels[0]), info)
+	}
+}
+
+// Test decoding a file from the reference encoder. Its MD5 signature of
+// the audio is checked by DecodeFlac, and the samples at both ends were
+// cross-checked with github.com/mewkiz/flac.
+func TestReadFlacFile_Reference(t *testing.T) {
+	data, err := os.ReadFile("testdata/sine.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, channels, err := audio.DecodeFlac(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SampleRate != 44100 || info.NumChannels != 1 || info.BitsPerSample != 16 || info.TotalSamples != 22050 {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+	if info.MD5 == [16]byte{} {
+		t.Error("expected the reference encoder to store an MD5 signature")
+	}
+	samples := channels[0]
+	if len(samples) != 22050 {
+		t.Fatalf("expected 22050 samples, got %d", len(samples))
+	}
+	head, tail := []int32{1, 1640, 3281, 4898, 6507, 8081, 9631, 11136}, []int32{-2384, -1928, -1388, -818}
+	if !reflect.DeepEqual(samples[:8], head) || !reflect.DeepEqual(samples[len(samples)-4:], tail) {
+		t.Errorf("expected samples to start with %v and end with %v, got %v and %v", head, tail, samples[:8], samples[len(samples)-4:])
+	}
+
+	// The FLAC and WAV fixtures were made from the same sine, but not from
+	// each other, and differ by a few LSB.
+	original, _, err := audio.ReadWavFile("testdata/sine.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range original {
+		if d := int(samples[i]) - int(v); d < -8 || d > 8 {
+			t.Fatalf("sample %d: expected %d within 8, got %d", i, v, samples[i])
+		}
+	}
+}
+
+// floatToExtended encodes a positive integer sample rate as an 80-bit
+// extended precision number.
+func floatToExtended(rate int) []byte {
+	exp := 16383 + 63
+	mantissa := uint64(rate)
+	for mantissa&(1<<63) == 0 {
+		mantissa <<= 1
+		exp--
+	}
+	b := make([]byte, 10)
+	binary.BigEndian.PutUint16(b[0:2], uint16(exp))
+	binary.BigEndian.PutUint64(b[2:10], mantissa)
+	return b
+}
+
+// encodeAiff builds an AIFF (or AIFF-C when compression is set) file from
+// already encoded sample bytes.
+func encodeAiff(numChannels, numFrames, sampleSize, sampleRate int, compression string, sound []byte) []byte {
+	comm := binary.BigEndian.AppendUint16(nil, uint16(numChannels))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(numFrames))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(sampleSize))
+	comm = append(comm, floatToExtended(sampleRate)...)
+	form := "AIFF"
+	if compression != "" {
+		form = "AIFC"
+		comm = append(comm, compression...)
+		comm = append(comm, 0, 0) // Empty compression name, padded.
+	}
+
+	body := []byte(form)
+	chunk := func(id string, data []byte) {
+		body = append(body, id...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(data)))
+		body = append(body, data...)
+		if len(data)%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+	chunk("NAME", []byte("odd")) // Odd-sized chunk before COMM.
+	chunk("COMM", comm)
+	chunk("SSND", append(make([]byte, 8), sound...))
+
+	out := []byte("FORM")
+	out = binary.BigEndian.AppendUint32(out, uint32(len(body)))
+	return append(out, body...)
+}
+
+// Test reading a stereo 16-bit big-endian AIFF file and downmixing to mono.
+func TestReadAiffFile_Stereo(t *testing.T) {
+	var sound []byte
+	for _, v := range []int16{100, 300, 200, 400, -100, -300, -200, -400} {
+		sound = binary.BigEndian.AppendUint16(sound, uint16(v))
+	}
+	path := writeTemp(t, "stereo*.aiff", encodeAiff(2, 4, 16, 44100, "", sound))
+
+	samples, sampleRate, err := audio.ReadAiffFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("expected sample rate 44100, got %d", sampleRate)
+	}
+	expected := []int16{200, 300, -200, -300}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected %v, got %v", expected, samples)
+	}
+}
+
+// Test the sample formats of AIFF and AIFF-C.
+func TestReadAiffFile_Formats(t *testing.T) {
+	tests := []struct {
+		name        string
+		sampleSize  int
+		compression string
+		sound       []byte
+		expected    []int16
+	}{
+		{
+			name:       "signed 8-bit",
+			sampleSize: 8,
+			sound:      []byte{0x7F, 0x80, 0x01},
+			expected:   []int16{0x7F00, -0x8000, 0x0100},
+		},
+		{
+			name:       "24-bit",
+			sampleSize: 24,
+			sound:      []byte{0x12, 0x34, 0x56, 0xFF, 0xFF, 0x00, 0x80, 0x00, 0x00},
+			expected:   []int16{0x1234, -1, -0x8000},
+		},
+		{
+			name:        "AIFF-C little-endian",
+			sampleSize:  16,
+			compression: "sowt",
+			sound:       []byte{0x34, 0x12, 0xFE, 0xFF, 0x00, 0x80},
+			expected:    []int16{0x1234, -2, -0x8000},
+		},
+		{
+			name:        "AIFF-C float",
+			sampleSize:  32,
+			compression: "fl32",
+			sound: binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil,
+				math.Float32bits(0.5)), math.Float32bits(-1)), math.Float32bits(2)),
+			expected: []int16{0x4000, -0x8000, 0x7FFF},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			width := (tc.sampleSize + 7) / 8
+			path := writeTemp(t, "format*.aif", encodeAiff(1, len(tc.sound)/width, tc.sampleSize, 48000, tc.compression, tc.sound))
+			samples, sampleRate, err := audio.ReadAiffFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sampleRate != 48000 {
+				t.Errorf("expected sample rate 48000, got %d", sampleRate)
+			}
+			if !reflect.DeepEqual(samples, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, samples)
+			}
+		})
+	}
+}
+
+func TestReadRawPCM(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   audio.RawFormat
+		data     []byte
+		expected []int16
+	}{
+		{
+			name:     "s16le stereo",
+			format:   audio.RawFormat{Encoding: "s16le", SampleRate: 48000, NumChannels: 2},
+			data:     []byte{0x00, 0x10, 0x00, 0x30, 0x00, 0x80, 0x00, 0x80},
+			expected: []int16{0x2000, -0x8000},
+		},
+		{
+			name:     "s24le mono",
+			format:   audio.RawFormat{Encoding: "s24le", SampleRate: 48000, NumChannels: 1},
+			data:     []byte{0x56, 0x34, 0x12, 0x00, 0xFF, 0xFF},
+			expected: []int16{0x1234, -1},
+		},
+		{
+			name:   "f32le mono",
+			format: audio.RawFormat{Encoding: "f32le", SampleRate: 48000, NumChannels: 1},
+			data: binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil,
+				math.Float32bits(0.5)), math.Float32bits(-1)),
+			expected: []int16{0x4000, -0x8000},
+		},
+		{
+			name:     "partial trailing frame",
+			format:   audio.RawFormat{Encoding: "s16le", SampleRate: 48000, NumChannels: 2},
+			data:     []byte{0x00, 0x10, 0x00, 0x10, 0x00},
+			expected: []int16{0x1000},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			samples, err := audio.ReadRawPCM(bytes.NewReader(tc.data), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(samples, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, samples)
+			}
+		})
+	}
+
+	if _, err := audio.ReadRawPCM(bytes.NewReader(nil), audio.RawFormat{Encoding: "u8", SampleRate: 8000, NumChannels: 1}); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+	if _, err := audio.ReadRawPCM(bytes.NewReader(nil), audio.RawFormat{Encoding: "s16le", SampleRate: 8000}); err == nil {
+		t.Error("expected error for zero channels")
+	}
+}
+
+// Test that ReadAudioFile dispatches on content rather than extension.
+func TestReadAudioFile_Sniffing(t *testing.T) {
+	var sound []byte
+	for _, v := range []int16{10, 20, 30} {
+		sound = binary.BigEndian.AppendUint16(sound, uint16(v))
+	}
+	aiff := writeTemp(t, "misnamed*.wav", encodeAiff(1, 3, 16, 22050, "", sound))
+	flac := writeTemp(t, "misnamed*.aiff", encodeFlac([][]int64{{10, 20, 30}}, 32000, 16, 3, []string{"verbatim"}))
+
+	// An ID3v2 tag in front of a FLAC stream is skipped.
+	tag := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05"), make([]byte, 5)...)
+	taggedData, _ := os.ReadFile(flac)
+	tagged := writeTemp(t, "tagged*.bin", append(tag, taggedData...))
+
+	for path, rate := range map[string]int{aiff: 22050, flac: 32000, tagged: 32000} {
+		samples, sampleRate, err := audio.ReadAudioFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if sampleRate != rate {
+			t.Errorf("%s: expected sample rate %d, got %d", path, rate, sampleRate)
+		}
+		if !reflect.DeepEqual(samples, []int16{10, 20, 30}) {
+			t.Errorf("%s: expected [10 20 30], got %v", path, samples)
+		}
+	}
+
+	if _, _, err := audio.ReadAudioFile(writeTemp(t, "unknown*.wav", []byte("not audio at all"))); err == nil {
+		t.Error("expected error for unrecognised format, got nil")
+	}
+}
+
+// Test decoding an MP3 with an ID3v2 tag and a LAME Info header against the
+// WAV it was encoded from. The fixtures come from github.com/gopxl/beep (MIT).
+func TestReadMp3File_MatchesWav(t *testing.T) {
+	original, rate, err := audio.ReadWavFile("testdata/sine.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, sampleRate, err := audio.ReadMp3File("testdata/sine.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != rate {
+		t.Errorf("expected sample rate %d, got %d", rate, sampleRate)
+	}
+	// Encoder delay and padding from the LAME tag are trimmed.
+	if len(decoded) != len(original) {
+		t.Fatalf("expected %d samples, got %d", len(original), len(decoded))
+	}
+
+	signal, noise := 0.0, 0.0
+	for i := range original {
+		d := float64(decoded[i]) - float64(original[i])
+		signal += float64(original[i]) * float64(original[i])
+		noise += d * d
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < 20 {
+		t.Errorf("expected decoded audio within 20 dB SNR of the original, got %.1f dB", snr)
+	}
+
+	want, err := fingerprint.Fingerprint(original, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fingerprint.Fingerprint(decoded, sampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSet := make(map[uint32]bool)
+	for _, h := range want {
+		wantSet[h] = true
+	}
+	shared := 0
+	for _, h := range got {
+		if wantSet[h] {
+			shared++
+		}
+	}
+	if len(want) == 0 || float64(shared) < 0.5*float64(len(want)) {
+		t.Errorf("expected at least half of %d hashes to survive MP3 coding, got %d", len(want), shared)
+	}
+
+	sniffed, _, err := audio.ReadAudioFile("testdata/sine.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sniffed, decoded) {
+		t.Error("expected ReadAudioFile to decode the MP3 like ReadMp3File")
+	}
+}
+
+func testOggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// oggPage builds a page with a valid checksum.
+func oggPage(headerType byte, granule int64, serial, seq uint32, lacing []byte, body []byte) []byte {
+	page := []byte("OggS\x00")
+	page = append(page, headerType)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = binary.LittleEndian.AppendUint32(page, seq)
+	page = append(page, 0, 0, 0, 0, byte(len(lacing)))
+	page = append(page, lacing...)
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:26], testOggCRC(page))
+	return page
+}
+
+// Test reassembling packets that span pages while skipping another stream.
+func TestOggReader(t *testing.T) {
+	long := bytes.Repeat([]byte{0xAB}, 600)
+	var stream []byte
+	stream = append(stream, oggPage(0x02, 0, 7, 0, []byte{4}, []byte("head"))...)
+	stream = append(stream, oggPage(0x02, 0, 9, 0, []byte{5}, []byte("other"))...)
+	stream = append(stream, oggPage(0x00, -1, 7, 1, []byte{255, 255}, long[:510])...)
+	stream = append(stream, oggPage(0x00, 0, 9, 1, []byte{3}, []byte("xyz"))...)
+	stream = append(stream, oggPage(0x05, 1234, 7, 2, []byte{90, 3}, append(long[510:], "end"...))...)
+
+	ogg := audio.NewOggReader(bytes.NewReader(stream))
+	expected := []struct {
+		packet  []byte
+		granule int64
+	}{
+		{[]byte("head"), 0},
+		{long, -1},
+		{[]byte("end"), 1234},
+	}
+	for i, want := range expected {
+		packet, granule, err := ogg.NextPacket()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if !bytes.Equal(packet, want.packet) || granule != want.granule {
+			t.Errorf("packet %d: expected %d bytes at granule %d, got %d bytes at granule %d",
+				i, len(want.packet), want.granule, len(packet), granule)
+		}
+	}
+	if _, _, err := ogg.NextPacket(); err != io.EOF {
+		t.Errorf("expected io.EOF after the EOS page, got %v", err)
+	}
+
+	corrupt := oggPage(0x02, 0, 7, 0, []byte{4}, []byte("head"))
+	corrupt[len(corrupt)-1] ^= 0xFF
+	if _, err := audio.ReadOggPage(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected checksum error for corrupted page, got nil")
+	}
+}
+
+// Test that a packet whose middle page is lost is dropped whole, including
+// its tail on the following continued pages.
+func TestOggReader_LostPage(t *testing.T) {
+	long := bytes.Repeat([]byte{0xCD}, 255)
+	var stream []byte
+	stream = append(stream, oggPage(0x02, 0, 7, 0, []byte{4}, []byte("head"))...)
+	stream = append(stream, oggPage(0x00, -1, 7, 1, []byte{255}, long)...)
+	// Page 2, the middle of the packet, is lost.
+	stream = append(stream, oggPage(0x01, -1, 7, 3, []byte{255}, long)...)
+	stream = append(stream, oggPage(0x05, 960, 7, 4, []byte{90, 4}, append(long[:90], "next"...))...)
+
+	ogg := audio.NewOggReader(bytes.NewReader(stream))
+	for i, want := range []string{"head", "next"} {
+		packet, _, err := ogg.NextPacket()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if string(packet) != want {
+			t.Errorf("packet %d: expected %q, got %d bytes", i, want, len(packet))
+		}
+	}
+	if _, _, err := ogg.NextPacket(); err != io.EOF {
+		t.Errorf("expected io.EOF after the EOS page, got %v", err)
+	}
+}
+
+// Test decoding an Ogg/Opus file: output is 48 kHz with the pre-skip removed
+// and the end trimmed to the final granule position.
+func TestReadOggFile_Opus(t *testing.T) {
+	samples, sampleRate, err := audio.ReadAudioFile("testdata/tiny.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 48000 {
+		t.Errorf("expected sample rate 48000, got %d", sampleRate)
+	}
+	// Final granule 591 minus a pre-skip of 312.
+	if len(samples) != 279 {
+		t.Errorf("expected 279 samples, got %d", len(samples))
+	}
+
+	vorbis := oggPage(0x06, 0, 1, 0, []byte{7}, []byte("\x01vorbis"))
+	if _, _, err := audio.DecodeOgg(bytes.NewReader(vorbis)); err == nil {
+		t.Error("expected error for Vorbis stream, got nil")
+	}
+}